@@ -124,6 +124,10 @@ type Things struct {
 
 //msgp:shim SpecialID as:[]byte using:toBytes/fromBytes
 
+// the shims of SpecialID and MyEnum, and CustomBytes,
+// encode as strings and byte slices of any length
+//msgp:unbounded SpecialID MyEnum CustomBytes
+
 type SpecialID string
 type TestObj struct{ ID1, ID2 SpecialID }
 
@@ -197,6 +201,7 @@ type Custom struct {
 	Some  FileHandle           `msg:"file_handle"`
 }
 
+//msgp:allocbound Files 16
 type Files []*os.File
 
 type FileHandle struct {
@@ -55,6 +55,8 @@ type OmitEmpty0 struct {
 type NamedBool bool
 type NamedInt int
 type NamedFloat64 float64
+//msgp:unbounded NamedString
+
 type NamedString string
 
 type EmbeddableStruct struct {
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/algorand/msgp/gen"
+)
+
+func TestCompat(t *testing.T) {
+	prim := func(p, bound string) *gen.Shape {
+		return &gen.Shape{Kind: gen.KindPrimitive, Primitive: p, AllocBound: bound}
+	}
+	old := &gen.Schema{Types: map[string]*gen.Shape{
+		"Gone": prim("uint64", ""),
+		"Rec": {Kind: gen.KindStruct, Fields: []gen.Field{
+			{Tag: "a", Name: "A", OmitEmpty: true, Shape: prim("string", "64")},
+			{Tag: "b", Name: "B", OmitEmpty: true, Shape: prim("uint64", "")},
+			{Tag: "c", Name: "C", OmitEmpty: true, Shape: prim("uint64", "")},
+			{Tag: "d", Name: "D", OmitEmpty: true, Shape: prim("string", "8")},
+		}},
+		"Tup": {Kind: gen.KindTuple, Fields: []gen.Field{
+			{Name: "X", Shape: prim("int64", "")},
+			{Name: "Y", Shape: prim("int64", "")},
+		}},
+	}}
+	new := &gen.Schema{Types: map[string]*gen.Shape{
+		"Added": prim("uint64", ""),
+		"Rec": {Kind: gen.KindStruct, Fields: []gen.Field{
+			{Tag: "a", Name: "Renamed", OmitEmpty: true, Shape: prim("string", "32")},
+			{Tag: "b", Name: "B", Shape: prim("uint64", "")},
+			{Tag: "c", Name: "C", OmitEmpty: true, Shape: prim("int64", "")},
+			{Tag: "d", Name: "D", OmitEmpty: true, Shape: prim("string", "16")},
+			{Tag: "e", Name: "E", OmitEmpty: true, Shape: prim("uint64", "")},
+			{Tag: "f", Name: "F", Shape: prim("uint64", "")},
+		}},
+		"Tup": {Kind: gen.KindTuple, Fields: []gen.Field{
+			{Name: "Y", Shape: prim("int64", "")},
+			{Name: "X", Shape: prim("int64", "")},
+		}},
+	}}
+
+	want := []gen.Change{
+		{Path: "Added", Breaking: false},
+		{Path: "Gone", Breaking: true},
+		{Path: "Rec.a", Breaking: false}, // renamed field
+		{Path: "Rec.a", Breaking: true},  // reduced allocbound
+		{Path: "Rec.b", Breaking: true},  // lost omitempty
+		{Path: "Rec.c", Breaking: true},  // changed element type
+		{Path: "Rec.d", Breaking: false}, // increased allocbound
+		{Path: "Rec.e", Breaking: false}, // added omitempty field
+		{Path: "Rec.f", Breaking: true},  // added field without omitempty
+		{Path: "Tup.0", Breaking: true},  // reordered
+		{Path: "Tup.1", Breaking: true},
+	}
+	got := gen.Compat(old, new)
+	if len(got) != len(want) {
+		t.Fatalf("changes are %v, expected %d", got, len(want))
+	}
+	for i := range want {
+		if got[i].Path != want[i].Path || got[i].Breaking != want[i].Breaking {
+			t.Errorf("change %d is %v, expected breaking=%v at %s", i, got[i], want[i].Breaking, want[i].Path)
+		}
+	}
+	if !gen.Breaking(got) || gen.Breaking(gen.Compat(old, old)) {
+		t.Errorf("Breaking is wrong")
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/algorand/msgp/gen"
+	"github.com/algorand/msgp/parse"
+)
+
+func TestDiagnosticPositions(t *testing.T) {
+	var buf bytes.Buffer
+	fss, err := parse.Packages(context.Background(), []string{"testdata/diagnostics.go"}, true, "", parse.LoadOptions{Diagnostics: &buf, JSON: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := fss[0]
+	var topics gen.Topics
+	if err := fs.PrintTo(gen.NewPrinter(gen.MaxSize, &topics, io.Discard, nil)); err == nil {
+		t.Fatal("expected an error for an unbounded slice")
+	}
+	if n := fs.Count(parse.Warning); n != 3 {
+		t.Errorf("%d warnings or errors, expected 3: %v", n, fs.Diagnostics)
+	}
+
+	for _, want := range []string{
+		"testdata/diagnostics.go:6:2: warning: Diag: Fn: ignored.",
+		"testdata/diagnostics.go:7:2: error: Diag: MaxSize of Diag is unbounded at Diag.Names",
+		"testdata/diagnostics.go:12:11: error: Enum: MaxSize of Enum is unbounded at Enum",
+	} {
+		found := false
+		for _, d := range fs.Diagnostics {
+			found = found || strings.HasPrefix(d.String(), want)
+		}
+		if !found {
+			t.Errorf("no diagnostic %q in %v", want, fs.Diagnostics)
+		}
+	}
+
+	dec := json.NewDecoder(&buf)
+	for _, want := range fs.Diagnostics {
+		var d parse.Diagnostic
+		if err := dec.Decode(&d); err != nil {
+			t.Fatal(err)
+		}
+		if d.File != want.File || d.Line != want.Line || d.Message != want.Message {
+			t.Errorf("printed %+v, expected %+v", d, want)
+		}
+	}
+}
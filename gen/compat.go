@@ -0,0 +1,240 @@
+package gen
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// A Change is a difference between two revisions of a Schema.
+// A change is breaking if objects encoded by one revision
+// decode differently, or encode to different canonical bytes,
+// with the other.
+type Change struct {
+	Path     string `json:"path"`
+	Message  string `json:"message"`
+	Breaking bool   `json:"breaking"`
+}
+
+func (c Change) String() string {
+	kind := "compatible"
+	if c.Breaking {
+		kind = "breaking"
+	}
+	return fmt.Sprintf("%s: %s: %s", kind, c.Path, c.Message)
+}
+
+// Compat returns the changes from schema old to schema new,
+// ordered by type name.
+func Compat(old, new *Schema) []Change {
+	var c compat
+	names := make([]string, 0, len(old.Types)+len(new.Types))
+	for name := range old.Types {
+		names = append(names, name)
+	}
+	for name := range new.Types {
+		if _, ok := old.Types[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		o, n := old.Types[name], new.Types[name]
+		switch {
+		case n == nil:
+			c.breakf(name, "type removed")
+		case o == nil:
+			c.compatf(name, "type added")
+		default:
+			c.shape(name, o, n)
+		}
+	}
+	return c.changes
+}
+
+// Breaking returns whether any of changes is breaking.
+func Breaking(changes []Change) bool {
+	for _, c := range changes {
+		if c.Breaking {
+			return true
+		}
+	}
+	return false
+}
+
+type compat struct {
+	changes []Change
+}
+
+func (c *compat) breakf(path string, format string, args ...interface{}) {
+	c.changes = append(c.changes, Change{Path: path, Message: fmt.Sprintf(format, args...), Breaking: true})
+}
+
+func (c *compat) compatf(path string, format string, args ...interface{}) {
+	c.changes = append(c.changes, Change{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// shape compares the shapes o and n of the element at path.
+func (c *compat) shape(path string, o, n *Shape) {
+	if o.Kind != n.Kind {
+		c.breakf(path, "encoded as %s instead of %s", n.Kind, o.Kind)
+		return
+	}
+	if o.Type != n.Type {
+		c.compatf(path, "type renamed from %q to %q", o.Type, n.Type)
+	}
+	c.bound(path, "allocbound", o.AllocBound, n.AllocBound)
+	c.bound(path, "maxtotalbytes", o.MaxTotalBytes, n.MaxTotalBytes)
+
+	switch o.Kind {
+	case KindPrimitive:
+		if o.Primitive != n.Primitive {
+			c.breakf(path, "element type changed from %s to %s", o.Primitive, n.Primitive)
+		}
+		if (o.Shim == nil) != (n.Shim == nil) || (o.Shim != nil && *o.Shim != *n.Shim) {
+			c.breakf(path, "shim changed from %s to %s", shimString(o.Shim), shimString(n.Shim))
+		}
+	case KindNamed:
+		if o.Ref != n.Ref {
+			c.breakf(path, "element type changed from %s to %s", o.Ref, n.Ref)
+		}
+	case KindExt:
+		if o.Type != n.Type {
+			c.breakf(path, "extension type changed from %s to %s", o.Type, n.Type)
+		}
+	case KindArray:
+		if o.Size != n.Size {
+			c.breakf(path, "array size changed from %s to %s", o.Size, n.Size)
+		}
+		c.shape(path+"[]", o.Elem, n.Elem)
+	case KindSlice:
+		c.shape(path+"[]", o.Elem, n.Elem)
+	case KindPtr:
+		c.shape(path, o.Elem, n.Elem)
+	case KindMap:
+		c.shape(path+"[key]", o.Key, n.Key)
+		c.shape(path+"[value]", o.Value, n.Value)
+	case KindStruct:
+		c.structFields(path, o.Fields, n.Fields)
+	case KindTuple:
+		c.tupleFields(path, o.Fields, n.Fields)
+	}
+}
+
+// structFields compares the fields of a struct encoded as a map,
+// which are matched by tag.
+func (c *compat) structFields(path string, o, n []Field) {
+	byTag := make(map[string]*Field, len(n))
+	for i := range n {
+		byTag[n[i].Tag] = &n[i]
+	}
+	for i := range o {
+		of := &o[i]
+		fpath := path + "." + of.Tag
+		nf, ok := byTag[of.Tag]
+		if !ok {
+			c.breakf(fpath, "field %s removed or renamed", of.Name)
+			continue
+		}
+		delete(byTag, of.Tag)
+		c.field(fpath, of, nf)
+	}
+	for i := range n {
+		nf := &n[i]
+		if _, ok := byTag[nf.Tag]; !ok {
+			continue
+		}
+		fpath := path + "." + nf.Tag
+		switch {
+		case nf.OmitEmpty || nf.Since != "":
+			c.compatf(fpath, "field %s added", nf.Name)
+		default:
+			c.breakf(fpath, "field %s added without omitempty", nf.Name)
+		}
+	}
+}
+
+// tupleFields compares the fields of a struct encoded
+// as an array, which are matched by position. A field
+// that moved to another position is breaking, but one
+// that was renamed in place is not.
+func (c *compat) tupleFields(path string, o, n []Field) {
+	if len(o) != len(n) {
+		c.breakf(path, "tuple of %d fields instead of %d", len(n), len(o))
+	}
+	pos := make(map[string]int, len(n))
+	for i := range n {
+		pos[n[i].Name] = i
+	}
+	for i := 0; i < len(o) && i < len(n); i++ {
+		fpath := path + "." + strconv.Itoa(i)
+		if j, ok := pos[o[i].Name]; ok && j != i {
+			c.breakf(fpath, "tuple field %s moved to position %d", o[i].Name, j)
+			continue
+		}
+		c.field(fpath, &o[i], &n[i])
+	}
+}
+
+func (c *compat) field(path string, o, n *Field) {
+	if o.Name != n.Name {
+		c.compatf(path, "field %s renamed to %s", o.Name, n.Name)
+	}
+	if o.OmitEmpty != n.OmitEmpty {
+		if o.OmitEmpty {
+			c.breakf(path, "omitempty removed")
+		} else {
+			c.breakf(path, "omitempty added")
+		}
+	}
+	if o.Since != n.Since || o.Until != n.Until {
+		c.breakf(path, "protocol versions changed from [%s, %s) to [%s, %s)", o.Since, o.Until, n.Since, n.Until)
+	}
+	aliases := make(map[string]bool, len(n.Aliases))
+	for _, a := range n.Aliases {
+		aliases[a] = true
+	}
+	for _, a := range o.Aliases {
+		if !aliases[a] {
+			c.breakf(path, "alias %q removed", a)
+		}
+	}
+	c.shape(path, o.Shape, n.Shape)
+}
+
+// bound compares the old and new values of the bound
+// kind, which are unbounded if they are "" or "-".
+// A bound can only grow; bounds that are not integer
+// literals are compared as expressions.
+func (c *compat) bound(path string, kind string, o, n string) {
+	if o == n {
+		return
+	}
+	unbounded := func(b string) bool { return b == "" || b == "-" }
+	switch {
+	case unbounded(o) && unbounded(n):
+		return
+	case unbounded(n):
+		c.compatf(path, "%s %s removed", kind, o)
+	case unbounded(o):
+		c.breakf(path, "%s %s added to an unbounded element", kind, n)
+	default:
+		ov, oerr := strconv.ParseUint(o, 0, 64)
+		nv, nerr := strconv.ParseUint(n, 0, 64)
+		switch {
+		case oerr != nil || nerr != nil:
+			c.breakf(path, "%s changed from %s to %s, which may reduce it", kind, o, n)
+		case nv < ov:
+			c.breakf(path, "%s reduced from %s to %s", kind, o, n)
+		default:
+			c.compatf(path, "%s increased from %s to %s", kind, o, n)
+		}
+	}
+}
+
+func shimString(s *Shim) string {
+	if s == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%s/%s (%s)", s.ToBase, s.FromBase, s.Mode)
+}
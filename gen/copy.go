@@ -0,0 +1,223 @@
+package gen
+
+import (
+	"go/ast"
+	"io"
+)
+
+func copies(w io.Writer, topics *Topics, st *printState) *copyGen {
+	return &copyGen{
+		p:      printer{w: w, state: st},
+		topics: topics,
+	}
+}
+
+// copyGen emits MsgCopy methods, which deep-copy the
+// encoded fields of a value without going through bytes.
+//
+// The source of each copy is the Varname() of the Elem
+// being visited; the destination is derived from it by
+// substituting the outermost variable that is being
+// copied into.
+type copyGen struct {
+	Passes
+	p      printer
+	ctx    *Context
+	msgs   []Diagnostic
+	topics *Topics
+	dsts   varMap
+}
+
+func (c *copyGen) Method() Method { return Copy }
+
+func (c *copyGen) Apply(dirs []string) error {
+	return nil
+}
+
+func (c *copyGen) Execute(p Elem) ([]Diagnostic, error) {
+	c.msgs = nil
+	if !c.p.ok() {
+		return c.msgs, c.p.err
+	}
+	p = c.ApplyAll(p)
+	if p == nil {
+		return c.msgs, nil
+	}
+
+	// We might change p.Varname in MethodReceiver(); make a copy
+	// to not affect other code that will use p.
+	p = p.Copy()
+
+	c.ctx = &Context{}
+
+	c.p.comment("MsgCopy returns a deep copy of the encoded fields of this value")
+
+	if IsDangling(p) {
+		baseType := p.(*BaseElem).IdentName
+		ptrName := p.Varname()
+		receiver := MethodReceiver(p)
+		c.p.printf("\nfunc (%s %s) MsgCopy() %s {", ptrName, receiver, p.TypeName())
+		c.p.printf("\n  return %s(((*(%s))(%s)).MsgCopy())", p.TypeName(), baseType, ptrName)
+		c.p.printf("\n}")
+		c.topics.Add(receiver, "MsgCopy")
+		return c.msgs, c.p.err
+	}
+
+	ptrName := p.Varname()
+	receiver := MethodReceiver(p)
+	c.dsts = nil
+	c.dsts.push(p.Varname(), "o")
+	c.p.printf("\nfunc (%s %s) MsgCopy() (o %s) {", ptrName, receiver, p.TypeName())
+	Next(c, p)
+	c.p.nakedReturn()
+
+	c.topics.Add(receiver, "MsgCopy")
+	return c.msgs, c.p.err
+}
+
+// is the element copied correctly by plain assignment?
+func assignCopies(e Elem) bool {
+	switch e := e.(type) {
+	case *BaseElem:
+		switch e.Value {
+		case Bytes, IDENT, Intf, Ext:
+			return false
+		}
+		return e.ShimToBase == ""
+	case *Array:
+		return assignCopies(e.Els)
+	default:
+		return false
+	}
+}
+
+func (c *copyGen) GStruct(s *Struct) {
+	if !c.p.ok() {
+		return
+	}
+	for i := range s.Fields {
+		if !ast.IsExported(s.Fields[i].FieldName) {
+			continue
+		}
+		c.ctx.PushString(s.Fields[i].FieldName)
+		Next(c, s.Fields[i].FieldElem)
+		c.ctx.Pop()
+	}
+}
+
+func (c *copyGen) GSlice(s *Slice) {
+	if !c.p.ok() {
+		return
+	}
+	src := s.Varname()
+	dst := c.dsts.name(src)
+	c.p.printf("\nif %s != nil {", src)
+	c.p.printf("\n%s = make(%s, len(%s))", dst, s.TypeName(), src)
+	if assignCopies(s.Els) {
+		c.p.printf("\ncopy(%s, %s)", dst, src)
+	} else {
+		c.p.rangeBlock(c.ctx, s.Index, src, c, s.Els)
+	}
+	c.p.closeblock()
+}
+
+func (c *copyGen) GArray(a *Array) {
+	if !c.p.ok() {
+		return
+	}
+	src := a.Varname()
+	if assignCopies(a) {
+		c.p.printf("\n%s = %s", c.dsts.name(src), src)
+		return
+	}
+	c.p.rangeBlock(c.ctx, a.Index, src, c, a.Els)
+}
+
+func (c *copyGen) GMap(m *Map) {
+	if !c.p.ok() {
+		return
+	}
+	src := m.Varname()
+	dst := c.dsts.name(src)
+	vdst := c.p.randIdent()
+	c.p.printf("\nif %s != nil {", src)
+	c.p.printf("\n%s = make(%s, len(%s))", dst, m.TypeName(), src)
+	c.p.printf("\nfor %s, %s := range %s {", m.Keyidx, m.Validx, src)
+	c.p.printf("\n_ = %s", m.Validx) // we may not use the value, if it's a struct{}
+	c.p.printf("\nvar %s %s", vdst, m.Value.TypeName())
+	c.dsts.push(m.Validx, vdst)
+	c.ctx.PushVar(m.Keyidx)
+	Next(c, m.Value)
+	c.ctx.Pop()
+	c.dsts.pop()
+	c.p.printf("\n%s[%s] = %s", dst, m.Keyidx, vdst)
+	c.p.closeblock()
+	c.p.closeblock()
+}
+
+func (c *copyGen) GPtr(p *Ptr) {
+	if !c.p.ok() {
+		return
+	}
+	src := p.Varname()
+	dst := c.dsts.name(src)
+	c.p.printf("\nif %s != nil {", src)
+	c.p.printf("\n%s = new(%s)", dst, p.Value.TypeName())
+	if be, ok := p.Value.(*BaseElem); ok && be.Value == IDENT && be.Varname() == src {
+		// identities keep the pointer as their receiver
+		c.p.printf("\n*%s = %s.MsgCopy()", dst, src)
+	} else {
+		Next(c, p.Value)
+	}
+	c.p.closeblock()
+}
+
+func (c *copyGen) GBase(b *BaseElem) {
+	if !c.p.ok() {
+		return
+	}
+	src := stripRef(b.Varname())
+	dst := c.dsts.name(src)
+
+	if b.Convert && b.ShimMode == Convert {
+		c.msgs = append(c.msgs, diagf(b, "MsgCopy does not support convert-mode shim on %s", b.TypeName()))
+		return
+	}
+	if b.TypeParamPtr != "" {
+		c.msgs = append(c.msgs, diagf(b, "MsgCopy does not support type parameter %s", b.TypeName()))
+		return
+	}
+
+	switch b.Value {
+	case Intf, Ext:
+		// the concrete value behind an interface or an
+		// extension cannot be copied, only shared
+		kind := "interface"
+		if b.Value == Ext {
+			kind = "extension"
+		}
+		c.msgs = append(c.msgs, diagf(b, "MsgCopy does not support %s field of type %s", kind, b.TypeName()))
+	case IDENT:
+		c.p.printf("\n%s = %s.MsgCopy()", dst, src)
+	case Bytes:
+		// copy the shimmed value, so that a shim
+		// that shares memory is copied as well
+		base := src
+		if b.Convert {
+			base = b.ToBase() + "(" + src + ")"
+		}
+		c.p.printf("\nif %s != nil {", base)
+		if b.Convert {
+			c.p.printf("\n%s = %s(append([]byte{}, %s...))", dst, b.FromBase(), base)
+		} else {
+			c.p.printf("\n%s = append([]byte{}, %s...)", dst, base)
+		}
+		c.p.closeblock()
+	default:
+		if b.ShimToBase != "" {
+			c.p.printf("\n%s = %s(%s(%s))", dst, b.FromBase(), b.ToBase(), src)
+		} else {
+			c.p.printf("\n%s = %s", dst, src)
+		}
+	}
+}
@@ -3,24 +3,27 @@ package gen
 import (
 	"fmt"
 	"go/ast"
+	"go/token"
 	"strconv"
 	"strings"
 )
 
-var (
-	identNext   = 0
-	identPrefix = "za"
-)
+// identGen generates the names of the
+// variables declared by generated code.
+type identGen struct {
+	prefix string
+	next   int
+}
 
-func resetIdent(prefix string) {
-	identPrefix = prefix
-	identNext = 0
+func (g *identGen) reset(prefix string) {
+	g.prefix = prefix
+	g.next = 0
 }
 
 // generate a random identifier name
-func randIdent() string {
-	identNext++
-	return fmt.Sprintf("%s%04d", identPrefix, identNext)
+func (g *identGen) randIdent() string {
+	g.next++
+	return fmt.Sprintf("%s%04d", g.prefix, g.next)
 }
 
 // This code defines the type declaration tree.
@@ -153,26 +156,52 @@ const UnmarshalCallBack CallbackType = 1
 func (c Callback) IsUnmarshallCallback() bool { return c.CallbackType == UnmarshalCallBack }
 func (c Callback) GetName() string            { return c.Fname }
 
+// TypeParams are the type parameters of a generic type.
+type TypeParams struct {
+	Decl  string // declaration, e.g. "[T any, PT msgp.Msg[T]]"
+	Names string // names, e.g. "[T, PT]"
+}
+
 // common data/methods for every Elem
 type common struct {
 	vname, alias  string
 	allocbound    string
 	maxtotalbytes string
 	callbacks     []Callback
+	typeParams    *TypeParams
+	pos           token.Pos
+
+	// the state of the Printer printing the
+	// Elem, set when printing starts; see attach
+	state *printState
+}
+
+func (c *common) SetVarname(s string)          { c.vname = s }
+func (c *common) Varname() string              { return c.vname }
+func (c *common) Alias(typ string)             { c.alias = typ }
+func (c *common) SortInterface() string        { return "" }
+func (c *common) setState(st *printState)      { c.state = st }
+func (c *common) SetAllocBound(s string)       { c.allocbound = s }
+func (c *common) AllocBound() string           { return c.allocbound }
+func (c *common) SetMaxTotalBytes(s string)    { c.maxtotalbytes = s }
+func (c *common) MaxTotalBytes() string        { return c.maxtotalbytes }
+func (c *common) GetCallbacks() []Callback     { return c.callbacks }
+func (c *common) AddCallback(cb Callback)      { c.callbacks = append(c.callbacks, cb) }
+func (c *common) SetTypeParams(tp *TypeParams) { c.typeParams = tp }
+func (c *common) TypeParams() *TypeParams      { return c.typeParams }
+func (c *common) SetPos(pos token.Pos)         { c.pos = pos }
+func (c *common) Pos() token.Pos               { return c.pos }
+func (c *common) hidden()                      {}
+
+// randIdent generates an identifier with the
+// identGen of the Printer printing c.
+func (c *common) randIdent() string {
+	if c.state == nil {
+		panic("msgp: Elem printed without a Printer")
+	}
+	return c.state.ids.randIdent()
 }
 
-func (c *common) SetVarname(s string)       { c.vname = s }
-func (c *common) Varname() string           { return c.vname }
-func (c *common) Alias(typ string)          { c.alias = typ }
-func (c *common) SortInterface() string     { return "" }
-func (c *common) SetAllocBound(s string)    { c.allocbound = s }
-func (c *common) AllocBound() string        { return c.allocbound }
-func (c *common) SetMaxTotalBytes(s string) { c.maxtotalbytes = s }
-func (c *common) MaxTotalBytes() string     { return c.maxtotalbytes }
-func (c *common) GetCallbacks() []Callback  { return c.callbacks }
-func (c *common) AddCallback(cb Callback)   { c.callbacks = append(c.callbacks, cb) }
-func (c *common) hidden()                   {}
-
 func IsDangling(e Elem) bool {
 	if be, ok := e.(*BaseElem); ok && be.Dangling() {
 		return true
@@ -208,6 +237,14 @@ type Elem interface {
 	// Copy should perform a deep copy of the object
 	Copy() Elem
 
+	// Pos returns the position in the source
+	// of the declaration of the element, or
+	// token.NoPos if it is not known.
+	Pos() token.Pos
+
+	// SetPos sets the position of the element.
+	SetPos(pos token.Pos)
+
 	// Complexity returns a measure of the
 	// complexity of element (greater than
 	// or equal to 1.)
@@ -240,6 +277,14 @@ type Elem interface {
 	// Blank means unspecified bound.  "-" means no bound.
 	SetAllocBound(bound string)
 
+	// SetTypeParams marks a generic type, whose type
+	// name includes the names of its type parameters.
+	SetTypeParams(tp *TypeParams)
+
+	// TypeParams returns the type parameters of a
+	// generic type, or nil.
+	TypeParams() *TypeParams
+
 	// AllocBound returns the maximum number of elements to allocate
 	// when decoding this type.  Meaningful for slices and maps.
 	AllocBound() string
@@ -259,6 +304,7 @@ type Elem interface {
 	// GetCallbacks fetches all callbacks this Elem stored.
 	GetCallbacks() []Callback
 
+	setState(*printState)
 	hidden()
 }
 
@@ -286,7 +332,7 @@ type Array struct {
 func (a *Array) SetVarname(s string) {
 	a.common.SetVarname(s)
 ridx:
-	a.Index = randIdent()
+	a.Index = a.randIdent()
 
 	// try to avoid using the same
 	// index as a parent slice
@@ -383,8 +429,8 @@ type Map struct {
 func (m *Map) SetVarname(s string) {
 	m.common.SetVarname(s)
 ridx:
-	m.Keyidx = randIdent()
-	m.Validx = randIdent()
+	m.Keyidx = m.randIdent()
+	m.Validx = m.randIdent()
 
 	// just in case
 	if m.Keyidx == m.Validx {
@@ -431,7 +477,7 @@ type Slice struct {
 
 func (s *Slice) SetVarname(a string) {
 	s.common.SetVarname(a)
-	s.Index = randIdent()
+	s.Index = s.randIdent()
 	varName := s.Varname()
 	if varName[0] == '*' {
 		// Pointer-to-slice requires parenthesis for slicing.
@@ -487,8 +533,9 @@ func (s *Ptr) SetVarname(a string) {
 
 	case *BaseElem:
 		// identities have pointer receivers
-		if x.Value == IDENT {
+		if x.Value == IDENT && x.TypeParamPtr == "" {
 			x.SetVarname(a)
+			x.ptrVarname = true
 		} else {
 			x.SetVarname("*" + a)
 		}
@@ -671,6 +718,51 @@ type StructField struct {
 	FieldName     string   // the name of the struct field
 	FieldElem     Elem     // the field type
 	FieldPath     []string // set of embedded struct names for accessing FieldName
+	Since         string   // first protocol version in which the field is valid, or empty
+	Until         string   // first protocol version in which the field is no longer valid, or empty
+	Aliases       []string // old wire keys accepted when decoding
+}
+
+// HasAlias returns true if the field accepts
+// the given old wire key.
+func (sf *StructField) HasAlias(alias string) bool {
+	for _, a := range sf.Aliases {
+		if a == alias {
+			return true
+		}
+	}
+	return false
+}
+
+// Versioned returns true if the field is gated by
+// a since= or until= tag part.
+func (sf *StructField) Versioned() bool {
+	return sf.Since != "" || sf.Until != ""
+}
+
+// VersionCheckExpr returns the expression that checks
+// whether the field is valid for the protocol version
+// held in the named variable.
+func (sf *StructField) VersionCheckExpr(version string) string {
+	since, until := sf.Since, sf.Until
+	if since == "" {
+		since = "0"
+	}
+	if until == "" {
+		until = "0"
+	}
+	return fmt.Sprintf("msgp.InVersionRange(%s, uint64(%s), uint64(%s))", version, since, until)
+}
+
+// AnyVersioned returns true if any field is gated
+// by a since= or until= tag part.
+func (s *Struct) AnyVersioned() bool {
+	for i := range s.Fields {
+		if s.Fields[i].Versioned() {
+			return true
+		}
+	}
+	return false
 }
 
 type byFieldTag []StructField
@@ -709,9 +801,11 @@ type BaseElem struct {
 	ShimFromBase string    // shim from base type, or empty
 	Value        Primitive // Type of element
 	IdentName    string    // name, for Value == IDENT
+	TypeParamPtr string    // for a type parameter, its pointer type parameter (constrained by msgp.Msg)
 	Convert      bool      // should we do an explicit conversion?
 	mustinline   bool      // must inline; not printable
 	needsref     bool      // needs reference for shim
+	ptrVarname   bool      // the Varname is a pointer to the value, under a Ptr
 }
 
 func (s *BaseElem) Dangling() bool { return s.mustinline }
@@ -727,6 +821,13 @@ func (s *BaseElem) Alias(typ string) {
 }
 
 func (s *BaseElem) SetVarname(a string) {
+	// the methods of type parameters are
+	// called through their pointer type
+	if s.TypeParamPtr != "" {
+		s.common.SetVarname(s.TypeParamPtr + "(&" + a + ")")
+		return
+	}
+
 	// extensions whose parents
 	// are not pointers need to
 	// be explicitly referenced
@@ -864,6 +965,9 @@ func (s *BaseElem) ZeroExpr() string {
 	case Bool:
 		return "false"
 
+	case Intf:
+		return "nil"
+
 	case Time:
 		return "(time.Time{})"
 	}
@@ -885,6 +989,10 @@ func (s *BaseElem) IfZeroExpr() string {
 		// and that it has generated code for MsgIsZero.
 		return s.Varname() + ".MsgIsZero()"
 	}
+	if s.ShimToBase != "" && s.ShimMode == Cast {
+		// the zero value is that of the encoded type
+		return tobaseConvert(s) + " == " + z
+	}
 	return s.Varname() + " == " + z
 }
 
@@ -902,11 +1010,11 @@ func (s *BaseElem) Comparable() bool {
 
 // SortInterface returns a sort.Interface for sorting a slice of this type.
 func (s *BaseElem) SortInterface() string {
-	sortIntf, ok := sortInterface[s.TypeName()]
-	if ok {
-		return sortIntf
+	if s.state == nil {
+		return ""
 	}
-	return ""
+	sortIntf, _ := s.state.reg.sortInterface(s.TypeName())
+	return sortIntf
 }
 
 func (k Primitive) String() string {
@@ -973,20 +1081,3 @@ func writeStructFields(s []StructField, name string) {
 		s[i].FieldElem.SetVarname(fmt.Sprintf("%s%s.%s", name, path, s[i].FieldName))
 	}
 }
-
-// SetSortInterface registers sort.Interface types from
-// the msgp:sort directive.  It would have been nice to
-// register it inside the Elem, but unfortunately that
-// only affects the type definition; call sites that
-// refer to that type (e.g., map keys) have a different
-// Elem that does not inherit (get copied) from the type
-// definition in f.Identities.
-var sortInterface map[string]string
-
-func SetSortInterface(sorttype string, sortintf string) {
-	if sortInterface == nil {
-		sortInterface = make(map[string]string)
-	}
-
-	sortInterface[sorttype] = sortintf
-}
@@ -0,0 +1,238 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+)
+
+func equals(w io.Writer, topics *Topics, st *printState) *equalGen {
+	return &equalGen{
+		p:      printer{w: w, state: st},
+		topics: topics,
+	}
+}
+
+// equalGen emits MsgEqual methods, which report whether
+// two values would have byte-identical encodings. The
+// traversal follows the marshal generator: fields left
+// out by omitempty only need to agree on being empty,
+// and nil and empty containers differ unless omitted.
+//
+// The other value's variables are derived from the
+// Varname() of the Elem being visited.
+type equalGen struct {
+	Passes
+	p      printer
+	ctx    *Context
+	msgs   []Diagnostic
+	topics *Topics
+	others varMap
+}
+
+func (e *equalGen) Method() Method { return Equal }
+
+func (e *equalGen) Apply(dirs []string) error {
+	return nil
+}
+
+func (e *equalGen) Execute(p Elem) ([]Diagnostic, error) {
+	e.msgs = nil
+	if !e.p.ok() {
+		return e.msgs, e.p.err
+	}
+	p = e.ApplyAll(p)
+	if p == nil {
+		return e.msgs, nil
+	}
+
+	// We might change p.Varname in MethodReceiver(); make a copy
+	// to not affect other code that will use p.
+	p = p.Copy()
+
+	e.ctx = &Context{}
+
+	e.p.comment("MsgEqual reports whether this value and o have the same encoding")
+
+	if IsDangling(p) {
+		baseType := p.(*BaseElem).IdentName
+		ptrName := p.Varname()
+		receiver := MethodReceiver(p)
+		e.p.printf("\nfunc (%s %s) MsgEqual(o %s) bool {", ptrName, receiver, receiver)
+		e.p.printf("\n  return ((*(%[1]s))(%[2]s)).MsgEqual((*(%[1]s))(o))", baseType, ptrName)
+		e.p.printf("\n}")
+		e.topics.Add(receiver, "MsgEqual")
+		return e.msgs, e.p.err
+	}
+
+	ptrName := p.Varname()
+	receiver := MethodReceiver(p)
+	e.others = nil
+	e.others.push(p.Varname(), "(*o)")
+	e.p.printf("\nfunc (%s %s) MsgEqual(o %s) bool {", ptrName, receiver, receiver)
+	Next(e, p)
+	if e.p.ok() {
+		e.p.print("\nreturn true\n}\n")
+	}
+
+	e.topics.Add(receiver, "MsgEqual")
+	return e.msgs, e.p.err
+}
+
+// is the element's encoding equal exactly when its
+// value is equal under ==, including the zero value?
+func plainEqual(e Elem) bool {
+	be, ok := e.(*BaseElem)
+	if !ok || be.ShimToBase != "" {
+		return false
+	}
+	switch be.Value {
+	case String, Bool, Byte, Duration,
+		Uint, Uint8, Uint16, Uint32, Uint64,
+		Int, Int8, Int16, Int32, Int64:
+		return true
+	default:
+		return false
+	}
+}
+
+// fail prints a check that returns false when cond holds.
+func (e *equalGen) fail(cond string) {
+	e.p.printf("\nif %s {\nreturn false\n}", cond)
+}
+
+func (e *equalGen) GStruct(s *Struct) {
+	if !e.p.ok() {
+		return
+	}
+	for i := range s.Fields {
+		sf := s.Fields[i]
+		if !s.AsTuple && !ast.IsExported(sf.FieldName) {
+			continue
+		}
+
+		// fields left out by omitempty are equal when
+		// they are both empty, and differ when only
+		// one of them is
+		ize := ""
+		if !s.AsTuple && isFieldOmitEmpty(sf, s) && !plainEqual(sf.FieldElem) {
+			ize = sf.FieldElem.IfZeroExpr()
+		}
+
+		e.ctx.PushString(sf.FieldName)
+		if ize != "" {
+			e.fail(fmt.Sprintf("(%s) != (%s)", ize, e.others.expr(ize)))
+			e.p.printf("\nif !(%s) {", ize)
+		}
+		Next(e, sf.FieldElem)
+		if ize != "" {
+			e.p.closeblock()
+		}
+		e.ctx.Pop()
+	}
+}
+
+func (e *equalGen) GSlice(s *Slice) {
+	if !e.p.ok() {
+		return
+	}
+	vn := s.Varname()
+	on := e.others.name(vn)
+	e.fail(fmt.Sprintf("(%[1]s == nil) != (%[2]s == nil) || len(%[1]s) != len(%[2]s)", vn, on))
+	e.p.rangeBlock(e.ctx, s.Index, vn, e, s.Els)
+}
+
+func (e *equalGen) GArray(a *Array) {
+	if !e.p.ok() {
+		return
+	}
+	if be, ok := a.Els.(*BaseElem); ok && be.Value == Byte {
+		e.fail(fmt.Sprintf("%s != %s", a.Varname(), e.others.name(a.Varname())))
+		return
+	}
+	e.p.rangeBlock(e.ctx, a.Index, a.Varname(), e, a.Els)
+}
+
+func (e *equalGen) GMap(m *Map) {
+	if !e.p.ok() {
+		return
+	}
+	vn := m.Varname()
+	on := e.others.name(vn)
+	oval := e.p.randIdent()
+	e.fail(fmt.Sprintf("(%[1]s == nil) != (%[2]s == nil) || len(%[1]s) != len(%[2]s)", vn, on))
+	e.p.printf("\nfor %s, %s := range %s {", m.Keyidx, m.Validx, vn)
+	e.p.printf("\n%s, ok := %s[%s]", oval, on, m.Keyidx)
+	e.fail("!ok")
+	e.p.printf("\n_, _ = %s, %s", m.Validx, oval) // we may not use the values, if they are struct{}
+	e.others.push(m.Validx, oval)
+	e.ctx.PushVar(m.Keyidx)
+	Next(e, m.Value)
+	e.ctx.Pop()
+	e.others.pop()
+	e.p.closeblock()
+}
+
+func (e *equalGen) GPtr(p *Ptr) {
+	if !e.p.ok() {
+		return
+	}
+	vn := p.Varname()
+	on := e.others.name(vn)
+	e.fail(fmt.Sprintf("(%s == nil) != (%s == nil)", vn, on))
+	e.p.printf("\nif %s != nil {", vn)
+	if be, ok := p.Value.(*BaseElem); ok && be.Value == IDENT && be.Varname() == vn {
+		// identities keep the pointer as their receiver
+		e.fail(fmt.Sprintf("!%s.MsgEqual(%s)", vn, on))
+	} else {
+		Next(e, p.Value)
+	}
+	e.p.closeblock()
+}
+
+func (e *equalGen) GBase(b *BaseElem) {
+	if !e.p.ok() {
+		return
+	}
+	vn := b.Varname()
+	on := e.others.name(vn)
+
+	if b.Convert && b.ShimMode == Convert {
+		e.msgs = append(e.msgs, diagf(b, "MsgEqual does not support convert-mode shim on %s", b.TypeName()))
+		return
+	}
+	if b.TypeParamPtr != "" {
+		e.msgs = append(e.msgs, diagf(b, "MsgEqual does not support type parameter %s", b.TypeName()))
+		return
+	}
+
+	// compare shimmed values on the wire representation
+	if b.Convert {
+		vn = b.ToBase() + "(" + vn + ")"
+		on = b.ToBase() + "(" + on + ")"
+	}
+
+	switch b.Value {
+	case IDENT:
+		e.fail(fmt.Sprintf("!%s.MsgEqual(&%s)", vn, on))
+	case Ext:
+		e.fail(fmt.Sprintf("!msgp.ExtensionEqual(%s, %s)", vn, on))
+	case Intf:
+		// the dynamic values have no generated MsgEqual
+		e.msgs = append(e.msgs, diagf(b, "MsgEqual does not support interface field of type %s", b.TypeName()))
+	case Bytes:
+		e.fail(fmt.Sprintf("(%[1]s == nil) != (%[2]s == nil) || string(%[1]s) != string(%[2]s)", vn, on))
+	case Float32:
+		e.fail(fmt.Sprintf("math.Float32bits(%s) != math.Float32bits(%s)", vn, on))
+	case Float64:
+		e.fail(fmt.Sprintf("math.Float64bits(%s) != math.Float64bits(%s)", vn, on))
+	case Complex64:
+		e.fail(fmt.Sprintf("math.Float32bits(real(%[1]s)) != math.Float32bits(real(%[2]s)) || math.Float32bits(imag(%[1]s)) != math.Float32bits(imag(%[2]s))", vn, on))
+	case Complex128:
+		e.fail(fmt.Sprintf("math.Float64bits(real(%[1]s)) != math.Float64bits(real(%[2]s)) || math.Float64bits(imag(%[1]s)) != math.Float64bits(imag(%[2]s))", vn, on))
+	case Time:
+		e.fail(fmt.Sprintf("!%s.Equal(%s)", vn, on))
+	default:
+		e.fail(fmt.Sprintf("%s != %s", vn, on))
+	}
+}
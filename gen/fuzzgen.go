@@ -0,0 +1,78 @@
+package gen
+
+import (
+	"io"
+	"text/template"
+)
+
+var (
+	fuzzTempl = template.New("Fuzz")
+)
+
+func fuzz(w io.Writer) *fuzzGen {
+	return &fuzzGen{w: w}
+}
+
+// fuzzGen emits native Go fuzz targets for the decoders,
+// seeded with the encodings of random values.
+type fuzzGen struct {
+	Passes
+	w io.Writer
+}
+
+func (f *fuzzGen) Execute(p Elem) ([]Diagnostic, error) {
+	p = f.ApplyAll(p)
+	// generic types can't be instantiated without type arguments
+	if p != nil && !IsDangling(p) && p.TypeParams() == nil {
+		switch p.(type) {
+		case *Struct, *Array, *Slice, *Map:
+			return nil, fuzzTempl.Execute(f.w, p)
+		}
+	}
+	return nil, nil
+}
+
+func (f *fuzzGen) Method() Method { return marshalfuzz }
+
+func init() {
+	template.Must(fuzzTempl.Parse(`func FuzzUnmarshal{{.TypeName}}(f *testing.F) {
+	r := rand.New(rand.NewSource(1))
+	f.Add((&{{.TypeName}}{}).MarshalMsg(nil))
+	for i := 0; i < 16; i++ {
+		var v {{.TypeName}}
+		v.RandomizeMsg(r, 4)
+		f.Add(v.MarshalMsg(nil))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var v {{.TypeName}}
+		var left []byte
+		var err error
+		if n := msgp.AllocatedBytes(func() { left, err = v.UnmarshalMsg(data) }); n > msgp.FuzzAllocLimit {
+			t.Fatalf("UnmarshalMsg() allocated %d bytes for %d bytes of input", n, len(data))
+		}
+		if err != nil {
+			return
+		}
+
+		skipped, err := msgp.Skip(data)
+		if err != nil {
+			t.Fatalf("UnmarshalMsg() accepted input that Skip() rejects: %v", err)
+		}
+		if len(skipped) != len(left) {
+			t.Fatalf("UnmarshalMsg() left %d bytes, but Skip() left %d bytes", len(left), len(skipped))
+		}
+
+		bts := v.MarshalMsg(nil)
+		var d {{.TypeName}}
+		if _, err := d.UnmarshalMsg(bts); err != nil {
+			t.Fatalf("re-encoding %x of %#v does not decode: %v", bts, v, err)
+		}
+		if again := d.MarshalMsg(nil); !bytes.Equal(bts, again) {
+			t.Fatalf("%#v was encoded as %x, but re-encoded as %x", v, bts, again)
+		}
+	})
+}
+
+`))
+}
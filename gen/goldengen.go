@@ -0,0 +1,47 @@
+package gen
+
+import (
+	"io"
+	"text/template"
+)
+
+var (
+	goldenTempl = template.New("Golden")
+)
+
+func golden(w io.Writer) *goldenGen {
+	return &goldenGen{w: w}
+}
+
+// goldenGen emits tests that check the canonical encodings
+// of random values against testdata/msgp/<Type>.golden,
+// which they rewrite if MSGP_UPDATE_GOLDEN is set.
+type goldenGen struct {
+	Passes
+	w io.Writer
+}
+
+func (g *goldenGen) Execute(p Elem) ([]Diagnostic, error) {
+	p = g.ApplyAll(p)
+	// generic types can't be instantiated without type arguments
+	if p != nil && !IsDangling(p) && p.TypeParams() == nil {
+		switch p.(type) {
+		case *Struct, *Array, *Slice, *Map:
+			return nil, goldenTempl.Execute(g.w, p)
+		}
+	}
+	return nil, nil
+}
+
+func (g *goldenGen) Method() Method { return marshalgolden }
+
+func init() {
+	template.Must(goldenTempl.Parse(`func TestGolden{{.TypeName}}(t *testing.T) {
+	file := filepath.Join("testdata", "msgp", "{{.TypeName}}.golden")
+	if err := msgp.CheckGolden[{{.TypeName}}](file, os.Getenv("MSGP_UPDATE_GOLDEN") != ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+`))
+}
@@ -4,15 +4,15 @@ import (
 	"io"
 )
 
-func isZeros(w io.Writer, topics *Topics) *isZeroGen {
+func isZeros(w io.Writer, topics *Topics, st *printState) *isZeroGen {
 	return &isZeroGen{
-		p:      printer{w: w},
+		p:      printer{w: w, state: st},
 		topics: topics,
 	}
 }
 
 type isZeroGen struct {
-	passes
+	Passes
 	p      printer
 	ctx    *Context
 	topics *Topics
@@ -24,16 +24,16 @@ func (s *isZeroGen) Apply(dirs []string) error {
 	return nil
 }
 
-func (s *isZeroGen) Execute(p Elem) ([]string, error) {
+func (s *isZeroGen) Execute(p Elem) ([]Diagnostic, error) {
 	if !s.p.ok() {
 		return nil, s.p.err
 	}
-	p = s.applyall(p)
+	p = s.ApplyAll(p)
 	if p == nil {
 		return nil, nil
 	}
 
-	// We might change p.Varname in methodReceiver(); make a copy
+	// We might change p.Varname in MethodReceiver(); make a copy
 	// to not affect other code that will use p.
 	p = p.Copy()
 
@@ -45,7 +45,7 @@ func (s *isZeroGen) Execute(p Elem) ([]string, error) {
 	if IsDangling(p) {
 		baseType := p.(*BaseElem).IdentName
 		ptrName := p.Varname()
-		receiver := methodReceiver(p)
+		receiver := MethodReceiver(p)
 		s.p.printf("\nfunc (%s %s) MsgIsZero() bool {", ptrName, receiver)
 		s.p.printf("\n  return ((*(%s))(%s)).MsgIsZero()", baseType, ptrName)
 		s.p.printf("\n}")
@@ -54,7 +54,7 @@ func (s *isZeroGen) Execute(p Elem) ([]string, error) {
 	}
 
 	ptrName := p.Varname()
-	receiver := imutMethodReceiver(p)
+	receiver := ImutMethodReceiver(p)
 	s.p.printf("\nfunc (%s %s) MsgIsZero() bool {", ptrName, receiver)
 	ize := p.IfZeroExpr()
 	if ize == "" {
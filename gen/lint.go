@@ -0,0 +1,166 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// Lint returns the constructs in e that threaten a canonical,
+// bounded encoding: floats, time.Time and interface{} values,
+// slices, maps and strings without an allocbound, map keys that
+// cannot be sorted, and structs with incomplete codec tags.
+// Structs without codec tags are not encoded, and are skipped.
+// Named types referenced by es are linted on their own, and
+// a finding is reported once for a position, even if the type
+// at the position was inlined into others. The types registered
+// in reg by the msgp:sort directive count as sortable map keys.
+func Lint(es []Elem, reg *Registry) []Diagnostic {
+	l := linter{seen: make(map[lintKey]bool), reg: reg}
+	for _, e := range es {
+		if s, ok := e.(*Struct); ok && !s.HasAnyStructTag() {
+			continue
+		}
+		l.top = e
+		l.elem(e, e.TypeName(), "")
+	}
+	return l.msgs
+}
+
+type linter struct {
+	msgs []Diagnostic
+	seen map[lintKey]bool
+	reg  *Registry
+
+	// the type being linted
+	top Elem
+
+	// a maxtotalbytes bounds the
+	// element being linted as a whole
+	capped bool
+}
+
+// a kind of finding at a position
+type lintKey struct {
+	pos    token.Pos
+	format string
+}
+
+func (l *linter) warnf(e Elem, format string, args ...interface{}) {
+	d := diagf(e, format, args...)
+	if !d.Pos.IsValid() {
+		d.Pos = l.top.Pos()
+	}
+	if d.Pos.IsValid() {
+		k := lintKey{pos: d.Pos, format: format}
+		if l.seen[k] {
+			return
+		}
+		l.seen[k] = true
+	}
+	l.msgs = append(l.msgs, d)
+}
+
+// elem lints e, found at path, whose allocbound
+// is bound unless e has an allocbound of its own.
+// Comma-separated allocbounds bound the elements
+// of slices, and the keys and values of maps.
+func (l *linter) elem(e Elem, path string, bound string) {
+	if e.AllocBound() != "" {
+		bound = e.AllocBound()
+	}
+	if e.MaxTotalBytes() != "" && !l.capped {
+		l.capped = true
+		defer func() { l.capped = false }()
+	}
+	bounds := strings.Split(bound, ",")
+	rest := func(i int) string {
+		if i < len(bounds) {
+			return bounds[i]
+		}
+		return ""
+	}
+
+	switch e := e.(type) {
+	case *Struct:
+		l.structFields(e, path)
+	case *Slice:
+		l.bounded(e, path, "slice", bound)
+		l.elem(e.Els, path+"[]", strings.Join(bounds[1:], ","))
+	case *Array:
+		l.elem(e.Els, path+"[]", bound)
+	case *Map:
+		l.bounded(e, path, "map", bound)
+		if !l.keysOrdered(e.Key) {
+			l.warnf(e, "map keys of %s cannot be sorted; add a //msgp:sort directive for %s", path, e.Key.TypeName())
+		}
+		l.elem(e.Key, path+"[key]", rest(1))
+		l.elem(e.Value, path+"[value]", rest(2))
+	case *Ptr:
+		l.elem(e.Value, path, bound)
+	case *BaseElem:
+		switch e.Value {
+		case Float32, Float64:
+			l.warnf(e, "%s is a float, whose NaN and -0 values have no canonical encoding", path)
+		case Time:
+			l.warnf(e, "%s is a time.Time, which decodes in the local time zone", path)
+		case Intf:
+			l.warnf(e, "%s is an interface{}, which has no canonical encoding", path)
+		case String:
+			l.bounded(e, path, "string", bound)
+		case Bytes:
+			l.bounded(e, path, "byte slice", bound)
+		}
+	}
+}
+
+// bounded warns if the element e of the given kind
+// has neither an allocbound nor a maxtotalbytes.
+// An allocbound of "-" marks it as unbounded on purpose.
+func (l *linter) bounded(e Elem, path string, kind string, bound string) {
+	if bound == "" && !l.capped {
+		l.warnf(e, "%s %s has no allocbound", kind, path)
+	}
+}
+
+func (l *linter) structFields(s *Struct, path string) {
+	if !s.HasAnyStructTag() {
+		return
+	}
+	if !s.HasUnderscoreStructTag() {
+		l.warnf(s, "struct %s has codec tags, but no _struct annotation", path)
+	}
+	for i := range s.Fields {
+		sf := &s.Fields[i]
+		// unexported fields of a map-encoded struct are not encoded
+		if sf.FieldName == "_struct" || (!s.AsTuple && !ast.IsExported(sf.FieldName)) {
+			continue
+		}
+		fpath := fmt.Sprintf("%s.%s", path, sf.FieldName)
+		if !sf.HasCodecTag && ast.IsExported(sf.FieldName) {
+			l.warnf(sf.FieldElem, "exported field %s has no codec tag, but other fields of %s do", fpath, path)
+		}
+		l.elem(sf.FieldElem, fpath, "")
+	}
+}
+
+// keysOrdered returns whether the marshalers can sort map keys
+// of type k; see sortKeys.
+func (l *linter) keysOrdered(k Elem) bool {
+	if be, ok := k.(*BaseElem); ok && be.Convert && be.ShimToBase != "" {
+		_, ok := l.reg.sortInterface(be.BaseType())
+		return ok || orderedKey(be.Value)
+	}
+	if _, ok := l.reg.sortInterface(k.TypeName()); ok {
+		return true
+	}
+	switch k := k.(type) {
+	case *BaseElem:
+		return orderedKey(k.Value)
+	case *Array:
+		be, ok := k.Els.(*BaseElem)
+		return ok && be.Value == Byte
+	}
+	return false
+}
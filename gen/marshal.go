@@ -10,19 +10,19 @@ import (
 	"github.com/algorand/msgp/msgp"
 )
 
-func marshal(w io.Writer, topics *Topics) *marshalGen {
+func marshal(w io.Writer, topics *Topics, st *printState) *marshalGen {
 	return &marshalGen{
-		p:      printer{w: w},
+		p:      printer{w: w, state: st},
 		topics: topics,
 	}
 }
 
 type marshalGen struct {
-	passes
+	Passes
 	p      printer
 	fuse   []byte
 	ctx    *Context
-	msgs   []string
+	msgs   []Diagnostic
 	topics *Topics
 }
 
@@ -32,38 +32,47 @@ func (m *marshalGen) Apply(dirs []string) error {
 	return nil
 }
 
-func (m *marshalGen) Execute(p Elem) ([]string, error) {
+func (m *marshalGen) Execute(p Elem) ([]Diagnostic, error) {
 	m.msgs = nil
 	if !m.p.ok() {
 		return m.msgs, m.p.err
 	}
-	p = m.applyall(p)
+	p = m.ApplyAll(p)
 	if p == nil {
 		return m.msgs, nil
 	}
 
-	// We might change p.Varname in methodReceiver(); make a copy
+	// We might change p.Varname in MethodReceiver(); make a copy
 	// to not affect other code that will use p.
 	p = p.Copy()
 
 	m.ctx = &Context{}
 
-	m.p.comment("MarshalMsg implements msgp.Marshaler")
-
 	if IsDangling(p) {
 		baseType := p.(*BaseElem).IdentName
 		c := p.Varname()
-		methodRecv := methodReceiver(p)
+		methodRecv := MethodReceiver(p)
+		m.p.comment("MarshalMsg implements msgp.Marshaler")
 		m.p.printf("\nfunc (%s %s) MarshalMsg(b []byte) []byte {", c, methodRecv)
 		m.p.printf("\n  return ((*(%s))(%s)).MarshalMsg(b)", baseType, c)
 		m.p.printf("\n}")
 
+		m.p.comment("MarshalMsgWithState implements msgp.MarshalerWithState")
+		m.p.printf("\nfunc (%s %s) MarshalMsgWithState(b []byte, st msgp.MarshalState) []byte {", c, methodRecv)
+		m.p.printf("\n  if ws, ok := interface{}((*(%s))(%s)).(msgp.MarshalerWithState); ok {", baseType, c)
+		m.p.printf("\n    return ws.MarshalMsgWithState(b, st)")
+		m.p.printf("\n  }")
+		m.p.printf("\n  return ((*(%s))(%s)).MarshalMsg(b)", baseType, c)
+		m.p.printf("\n}")
+
+		m.p.comment("CanMarshalMsg implements msgp.Marshaler")
 		m.p.printf("\nfunc (_ %[2]s) CanMarshalMsg(%[1]s interface{}) bool {", c, methodRecv)
 		m.p.printf("\n  _, ok := (%s).(%s)", c, methodRecv)
 		m.p.printf("\n  return ok")
 		m.p.printf("\n}")
 
 		m.topics.Add(methodRecv, "MarshalMsg")
+		m.topics.Add(methodRecv, "MarshalMsgWithState")
 		m.topics.Add(methodRecv, "CanMarshalMsg")
 
 		return m.msgs, m.p.err
@@ -73,13 +82,20 @@ func (m *marshalGen) Execute(p Elem) ([]string, error) {
 	// calling methodReceiver so
 	// that z.Msgsize() is printed correctly
 	c := p.Varname()
-	methodRecv := imutMethodReceiver(p)
+	methodRecv := ImutMethodReceiver(p)
 
-	m.p.printf("\nfunc (%s %s) MarshalMsg(b []byte) (o []byte) {", c, methodRecv)
+	m.p.comment("MarshalMsgWithState implements msgp.MarshalerWithState")
+	m.p.printf("\nfunc (%s %s) MarshalMsgWithState(b []byte, st msgp.MarshalState) (o []byte) {", c, methodRecv)
 	m.p.printf("\no = msgp.Require(b, %s.Msgsize())", c)
-	next(m, p)
+	Next(m, p)
 	m.p.nakedReturn()
 
+	m.p.comment("MarshalMsg implements msgp.Marshaler")
+	m.p.printf("\nfunc (%s %s) MarshalMsg(b []byte) []byte {", c, methodRecv)
+	m.p.printf("\n return %s.MarshalMsgWithState(b, msgp.DefaultMarshalState)", c)
+	m.p.printf("\n}")
+
+	m.p.comment("CanMarshalMsg implements msgp.Marshaler")
 	m.p.printf("\nfunc (_ %[2]s) CanMarshalMsg(%[1]s interface{}) bool {", c, methodRecv)
 	m.p.printf("\n  _, ok := (%s).(%s)", c, methodRecv)
 
@@ -94,6 +110,7 @@ func (m *marshalGen) Execute(p Elem) ([]string, error) {
 	m.p.printf("\n}")
 
 	m.topics.Add(methodRecv, "MarshalMsg")
+	m.topics.Add(methodRecv, "MarshalMsgWithState")
 	m.topics.Add(methodRecv, "CanMarshalMsg")
 
 	return m.msgs, m.p.err
@@ -118,7 +135,7 @@ func (m *marshalGen) Fuse(b []byte) {
 	}
 }
 
-func (m *marshalGen) gStruct(s *Struct) {
+func (m *marshalGen) GStruct(s *Struct) {
 	if !m.p.ok() {
 		return
 	}
@@ -132,6 +149,14 @@ func (m *marshalGen) gStruct(s *Struct) {
 }
 
 func (m *marshalGen) tuple(s *Struct) {
+	// Tuple fields are positional, so there is no way
+	// to leave out a field that is not valid for the
+	// protocol version being encoded.
+	if s.AnyVersioned() {
+		m.msgs = append(m.msgs, diagf(s, "Version-gated fields are not supported on tuple struct %v", s.TypeName()))
+		return
+	}
+
 	data := make([]byte, 0, 5)
 	data = msgp.AppendArrayHeader(data, uint32(len(s.Fields)))
 	m.p.printf("\n// array header, size %d", len(s.Fields))
@@ -144,7 +169,7 @@ func (m *marshalGen) tuple(s *Struct) {
 			return
 		}
 		m.ctx.PushString(s.Fields[i].FieldName)
-		next(m, s.Fields[i].FieldElem)
+		Next(m, s.Fields[i].FieldElem)
 		m.ctx.Pop()
 	}
 }
@@ -162,6 +187,25 @@ func isFieldOmitEmpty(sf StructField, s *Struct) bool {
 	return sf.HasTagPart(tagName) || s.UnderscoreStructHasTagPart(tagName)
 }
 
+// fieldOmitExpr returns the expression that is true when the
+// field must be left out of the encoding, or "" if the field
+// is always encoded.
+func fieldOmitExpr(sf StructField, s *Struct) string {
+	var omit string
+	if ize := sf.FieldElem.IfZeroExpr(); ize != "" && isFieldOmitEmpty(sf, s) {
+		omit = ize
+	}
+	if sf.Versioned() {
+		vc := "!" + sf.VersionCheckExpr("st.Version")
+		if omit == "" {
+			omit = vc
+		} else {
+			omit = "(" + omit + ") || " + vc
+		}
+	}
+	return omit
+}
+
 func (m *marshalGen) mapstruct(s *Struct) {
 
 	// Every struct must have a _struct annotation with a codec: tag.
@@ -169,14 +213,14 @@ func (m *marshalGen) mapstruct(s *Struct) {
 	// also be blank, if for some reason omitempty is not desired.  This
 	// check guards against developers forgetting to specify omitempty.
 	if !s.HasUnderscoreStructTag() {
-		m.msgs = append(m.msgs, fmt.Sprintf("Missing _struct annotation on struct %v", s))
+		m.msgs = append(m.msgs, diagf(s, "Missing _struct annotation on struct %s", s.TypeName()))
 		return
 	}
 
 	sortedFields := append([]StructField(nil), s.Fields...)
 	sort.Sort(byFieldTag(sortedFields))
 
-	oeIdentPrefix := randIdent()
+	oeIdentPrefix := m.p.randIdent()
 
 	var data []byte
 	nfields := len(sortedFields)
@@ -193,7 +237,9 @@ func (m *marshalGen) mapstruct(s *Struct) {
 		exportedFields++
 	}
 
-	omitempty := s.AnyHasTagPart("omitempty")
+	// Fields that are not valid for the protocol version being
+	// encoded are left out the same way as empty fields.
+	omitempty := s.AnyHasTagPart("omitempty") || s.AnyVersioned()
 	var fieldNVar string
 	needCloseBrace := false
 	needBmDecl := true
@@ -212,14 +258,13 @@ func (m *marshalGen) mapstruct(s *Struct) {
 				continue
 			}
 
-			fieldOmitEmpty := isFieldOmitEmpty(sf, s)
-			if ize := sf.FieldElem.IfZeroExpr(); ize != "" && fieldOmitEmpty {
+			if omit := fieldOmitExpr(sf, s); omit != "" {
 				if needBmDecl {
 					m.p.printf("\n%s", bm.typeDecl())
 					needBmDecl = false
 				}
 
-				m.p.printf("\nif %s {", ize)
+				m.p.printf("\nif %s {", omit)
 				m.p.printf("\n%s--", fieldNVar)
 				m.p.printf("\n%s", bm.setStmt(i))
 				m.p.printf("\n}")
@@ -260,10 +305,8 @@ func (m *marshalGen) mapstruct(s *Struct) {
 			return
 		}
 
-		fieldOmitEmpty := isFieldOmitEmpty(sf, s)
-
 		// if field is omitempty, wrap with if statement based on the emptymask
-		oeField := fieldOmitEmpty && sf.FieldElem.IfZeroExpr() != ""
+		oeField := fieldOmitExpr(sf, s) != ""
 		if oeField {
 			m.p.printf("\nif %s == 0 { // if not empty", bm.readExpr(i))
 		}
@@ -275,7 +318,7 @@ func (m *marshalGen) mapstruct(s *Struct) {
 		m.fuseHook()
 
 		m.ctx.PushString(sf.FieldName)
-		next(m, sf.FieldElem)
+		Next(m, sf.FieldElem)
 		m.ctx.Pop()
 
 		if oeField {
@@ -298,7 +341,7 @@ func (m *marshalGen) rawbytes(bts []byte) {
 	m.p.print(")")
 }
 
-func (m *marshalGen) gMap(s *Map) {
+func (m *marshalGen) GMap(s *Map) {
 	if !m.p.ok() {
 		return
 	}
@@ -310,24 +353,101 @@ func (m *marshalGen) gMap(s *Map) {
 	m.rawAppend(mapHeader, lenAsUint32, vname)
 	m.p.printf("\n}")
 
-	m.p.printf("\n%s_keys := make([]%s, 0, len(%s))", s.Keyidx, s.Key.TypeName(), vname)
+	// small maps sort their keys in a buffer on the stack
+	m.p.printf("\nvar %s_buf [%d]%s", s.Keyidx, sortedKeysBuffer, s.Key.TypeName())
+	m.p.printf("\n%s_keys := %s_buf[:0]", s.Keyidx, s.Keyidx)
+	m.p.printf("\nif len(%s) > len(%s_buf) {", vname, s.Keyidx)
+	m.p.printf("\n%s_keys = make([]%s, 0, len(%s))", s.Keyidx, s.Key.TypeName(), vname)
+	m.p.closeblock()
 	m.p.printf("\nfor %s := range %s {", s.Keyidx, vname)
 	m.p.printf("\n%s_keys = append(%s_keys, %s)", s.Keyidx, s.Keyidx, s.Keyidx)
 	m.p.closeblock()
 
-	m.p.printf("\nsort.Sort(%s(%s_keys))", s.Key.SortInterface(), s.Keyidx)
+	m.sortKeys(s)
 
 	m.p.printf("\nfor _, %s := range %s_keys {", s.Keyidx, s.Keyidx)
 	m.p.printf("\n%s := %s[%s]", s.Validx, vname, s.Keyidx)
 	m.p.printf("\n_ = %s", s.Validx) // we may not use the value, if it's a struct{}
 	m.ctx.PushVar(s.Keyidx)
-	next(m, s.Key)
-	next(m, s.Value)
+	Next(m, s.Key)
+	Next(m, s.Value)
 	m.ctx.Pop()
 	m.p.closeblock()
 }
 
-func (m *marshalGen) gSlice(s *Slice) {
+// sortedKeysBuffer is the number of map keys that
+// are sorted without allocating, in a buffer on the stack.
+const sortedKeysBuffer = 8
+
+// sortKeys sorts the keys of map s, collected in <Keyidx>_keys,
+// into canonical order: by the //msgp:sort interface of the key
+// type, if any, or else by the natural order of string, integer
+// and byte-array keys. The keys are sorted with the slices package,
+// since a sort.Interface would move the buffer of keys to the heap.
+func (m *marshalGen) sortKeys(s *Map) {
+	keys := s.Keyidx + "_keys"
+	if be, ok := s.Key.(*BaseElem); ok && be.Convert && be.ShimToBase != "" {
+		// a shim may order the keys differently than
+		// their encoding; sort by the on-wire values
+		a, b := be.Copy().(*BaseElem), be.Copy().(*BaseElem)
+		a.SetVarname("a")
+		b.SetVarname("b")
+		if intf, ok := m.p.state.reg.sortInterface(be.BaseType()); ok {
+			m.sortLess(keys, be.TypeName(), intf, tobaseConvert(a), tobaseConvert(b))
+			return
+		}
+		if !orderedKey(be.Value) {
+			m.msgs = append(m.msgs, diagf(be, "Map key type %s cannot be ordered; add a //msgp:sort directive for %s", be.TypeName(), be.BaseType()))
+			return
+		}
+		m.p.printf("\nslices.SortFunc(%s, func(a, b %s) int { return cmp.Compare(%s, %s) })", keys, be.TypeName(), tobaseConvert(a), tobaseConvert(b))
+		return
+	}
+
+	if intf, ok := m.p.state.reg.sortInterface(s.Key.TypeName()); ok {
+		m.sortLess(keys, s.Key.TypeName(), intf, "a", "b")
+		return
+	}
+	switch k := s.Key.(type) {
+	case *BaseElem:
+		if orderedKey(k.Value) {
+			m.p.printf("\nslices.Sort(%s)", keys)
+			return
+		}
+	case *Array:
+		if be, ok := k.Els.(*BaseElem); ok && be.Value == Byte {
+			m.p.printf("\nslices.SortFunc(%s, func(a, b %s) int { return bytes.Compare(a[:], b[:]) })", keys, k.TypeName())
+			return
+		}
+	}
+	m.msgs = append(m.msgs, diagf(s.Key, "Map key type %s cannot be ordered; add a //msgp:sort directive for it", s.Key.TypeName()))
+}
+
+// sortLess sorts keys, of type typ, with the Less method of the
+// sort.Interface intf, applied to the pair of expressions a and b.
+func (m *marshalGen) sortLess(keys, typ, intf, a, b string) {
+	m.p.printf("\nslices.SortFunc(%s, func(a, b %s) int {", keys, typ)
+	m.p.printf("\npair := %s{%s, %s}", intf, a, b)
+	m.p.printf("\nif pair.Less(0, 1) {\nreturn -1\n}")
+	m.p.printf("\nif pair.Less(1, 0) {\nreturn 1\n}")
+	m.p.printf("\nreturn 0")
+	m.p.printf("\n})")
+}
+
+// orderedKey returns whether map keys of primitive type v
+// are sorted in their natural order.
+func orderedKey(v Primitive) bool {
+	switch v {
+	case String, Byte, Duration,
+		Int, Int8, Int16, Int32, Int64,
+		Uint, Uint8, Uint16, Uint32, Uint64, Uintptr:
+		return true
+	default:
+		return false
+	}
+}
+
+func (m *marshalGen) GSlice(s *Slice) {
 	if !m.p.ok() {
 		return
 	}
@@ -341,7 +461,7 @@ func (m *marshalGen) gSlice(s *Slice) {
 	m.p.rangeBlock(m.ctx, s.Index, vname, m, s.Els)
 }
 
-func (m *marshalGen) gArray(a *Array) {
+func (m *marshalGen) GArray(a *Array) {
 	if !m.p.ok() {
 		return
 	}
@@ -355,17 +475,17 @@ func (m *marshalGen) gArray(a *Array) {
 	m.p.rangeBlock(m.ctx, a.Index, a.Varname(), m, a.Els)
 }
 
-func (m *marshalGen) gPtr(p *Ptr) {
+func (m *marshalGen) GPtr(p *Ptr) {
 	if !m.p.ok() {
 		return
 	}
 	m.fuseHook()
 	m.p.printf("\nif %s == nil {\no = msgp.AppendNil(o)\n} else {", p.Varname())
-	next(m, p.Value)
+	Next(m, p.Value)
 	m.p.closeblock()
 }
 
-func (m *marshalGen) gBase(b *BaseElem) {
+func (m *marshalGen) GBase(b *BaseElem) {
 	if !m.p.ok() {
 		return
 	}
@@ -373,10 +493,12 @@ func (m *marshalGen) gBase(b *BaseElem) {
 	vname := b.Varname()
 
 	if b.Convert {
-		if b.ShimMode == Cast {
+		// a cast cannot be addressed, as
+		// an identity is marshalled below
+		if b.ShimMode == Cast && b.Value != IDENT {
 			vname = tobaseConvert(b)
 		} else {
-			vname = randIdent()
+			vname = m.p.randIdent()
 			m.p.printf("\nvar %s %s", vname, b.BaseType())
 			m.p.printf("\n%s = %s", vname, tobaseConvert(b))
 		}
@@ -384,8 +506,23 @@ func (m *marshalGen) gBase(b *BaseElem) {
 
 	switch b.Value {
 	case IDENT:
+		// the identity is marshalled for the version
+		// in st if it implements MarshalerWithState,
+		// through a pointer, for pointer receivers
+		ref := "&" + vname
+		if (b.ptrVarname && !b.Convert) || b.TypeParamPtr != "" {
+			ref = vname
+		}
+		m.p.printf("\nif ws, ok := interface{}(%s).(msgp.MarshalerWithState); ok {", ref)
+		m.p.printf("\no = ws.MarshalMsgWithState(o, st)")
+		m.p.printf("\n} else {")
 		m.p.printf("\no = %s.MarshalMsg(o)", vname)
-	case Intf, Ext:
+		m.p.closeblock()
+	case Intf:
+		// the dynamic value may not be encodable,
+		// and could not be decoded into an interface
+		m.msgs = append(m.msgs, diagf(b, "Field of interface type %s has no MessagePack encoding; use a concrete type", b.BaseType()))
+	case Ext:
 		m.p.printf("\no = msgp.Append%s(o, %s)", b.BaseName(), vname)
 	default:
 		m.rawAppend(b.BaseName(), literalFmt, vname)
@@ -28,21 +28,24 @@ const (
 	// the result is multiplied by whatever is preceeding it
 )
 
-func maxSizes(w io.Writer, topics *Topics) *maxSizeGen {
+func maxSizes(w io.Writer, topics *Topics, st *printState) *maxSizeGen {
 	return &maxSizeGen{
-		p:      printer{w: w},
+		p:      printer{w: w, state: st},
 		state:  assignM,
 		topics: topics,
 	}
 }
 
 type maxSizeGen struct {
-	passes
-	p      printer
-	state  maxSizeState
-	ctx    *Context
-	topics *Topics
-	halted bool
+	Passes
+	p       printer
+	state   maxSizeState
+	ctx     *Context
+	topics  *Topics
+	halted  bool
+	checked bool     // generating MaxSizeChecked for an unbounded type
+	path    []string // path to the field being sized
+	msgs    []Diagnostic
 }
 
 func (s *maxSizeGen) Method() Method { return MaxSize }
@@ -79,60 +82,122 @@ func (s *maxSizeGen) addConstant(sz string) {
 	panic("unknown size state")
 }
 
-func (s *maxSizeGen) Execute(p Elem) ([]string, error) {
+func (s *maxSizeGen) Execute(p Elem) ([]Diagnostic, error) {
+	s.msgs = nil
 	if !s.p.ok() {
 		return nil, s.p.err
 	}
-	p = s.applyall(p)
+	p = s.ApplyAll(p)
 	if p == nil {
 		return nil, nil
 	}
 
-	// We might change p.Varname in methodReceiver(); make a copy
+	// We might change p.Varname in MethodReceiver(); make a copy
 	// to not affect other code that will use p.
 	p = p.Copy()
 
-	s.p.comment("MaxSize returns a maximum valid message size for this message type")
+	s.checked = s.p.state.reg.isUnbounded(p.TypeName())
+	method, results := getMaxSizeMethod, "int"
+	if s.checked {
+		method, results = getMaxSizeCheckedMethod, "(int, bool)"
+		s.p.comment("MaxSizeChecked returns a maximum valid message size for this message type, or false if the size is unbounded")
+	} else {
+		s.p.comment("MaxSize returns a maximum valid message size for this message type")
+	}
 
 	if IsDangling(p) {
 		baseType := p.(*BaseElem).IdentName
-		s.p.printf("\nfunc %s int{", getMaxSizeMethod(p.TypeName()))
-		s.p.printf("\n  return %s", getMaxSizeMethod(baseType))
+		s.p.printf("\nfunc %s %s{", method(p.TypeName()), results)
+		s.p.printf("\n  return %s", method(baseType))
 		s.p.printf("\n}")
-		s.topics.Add(baseType, getMaxSizeMethod(baseType))
+		s.topics.Add(baseType, method(baseType))
 		return nil, s.p.err
 	}
 
 	s.ctx = &Context{}
 	s.ctx.PushString(p.TypeName())
+	s.path = []string{p.TypeName()}
 
 	s.halted = false
 
-	// receiver := imutMethodReceiver(p)
-	s.p.printf("\nfunc  %s (s int) {", getMaxSizeMethod(p.TypeName()))
+	// receiver := ImutMethodReceiver(p)
+	if s.checked {
+		s.p.printf("\nfunc  %s (s int, ok bool) {", getMaxSizeDecl(p, getMaxSizeCheckedMethod))
+	} else {
+		s.p.printf("\nfunc  %s (s int) {", getMaxSizeDecl(p, getMaxSizeMethod))
+	}
 	s.state = assignM
-	next(s, p)
+	Next(s, p)
 	if s.halted {
 		if s.p.ok() {
 			s.p.print("\n}\n")
 		}
 	} else {
+		if s.checked {
+			s.p.print("\nok = true")
+		}
 		s.p.nakedReturn()
 	}
-	s.topics.Add(p.TypeName(), getMaxSizeMethod(p.TypeName()))
-	return nil, s.p.err
+	s.topics.Add(p.TypeName(), method(p.TypeName()))
+	return s.msgs, s.p.err
 }
 
-func (s *maxSizeGen) panicf(format string, args ...interface{}) {
+// unbounded stops sizing a type that turned out to be unbounded at e,
+// for the reason err. Types marked by //msgp:unbounded return false
+// from MaxSizeChecked; for any other type, this is an error.
+func (s *maxSizeGen) unbounded(e Elem, err error) {
 	if !s.p.ok() || s.halted {
 		return
 	}
 	s.state = addM
-	s.p.printf("\npanic(%s)", strconv.Quote(fmt.Sprintf(format, args...)))
 	s.halted = true
+	if s.checked {
+		s.p.print("\nreturn 0, false")
+		return
+	}
+	hint := "add"
+	if _, ok := err.(noBound); ok {
+		hint = s.boundHint() + ", or add"
+	}
+	s.msgs = append(s.msgs, diagf(e, "MaxSize of %s is unbounded at %s: %v; %s a //msgp:unbounded %s directive",
+		s.path[0], s.fieldPath(), err, hint, baseTypeName(s.path[0])))
+}
+
+// noBound is the error of a slice, map, string or
+// byte slice, of the given kind, without an allocbound.
+type noBound string
+
+func (k noBound) Error() string { return string(k) + " has no allocbound" }
+
+// boundHint tells how to bound the element at the end of the path.
+// The allocbound= parts of a tag bound, in order, a slice and its
+// elements, or a map, its keys and its values.
+func (s *maxSizeGen) boundHint() string {
+	switch s.path[len(s.path)-1] {
+	case "[key]":
+		return "bound the map keys with the allocbound= part after that of the map, as in allocbound=8,allocbound=64"
+	case "[value]":
+		return "bound the map values with the allocbound= part after that of the map keys, as in allocbound=8,allocbound=64,allocbound=64"
+	case "[]":
+		return "bound the slice elements with the allocbound= part after that of the slice, as in allocbound=8,allocbound=64"
+	}
+	return "add an allocbound"
+}
+
+// fieldPath returns the path to the field being sized,
+// such as T.Field[value].Inner for a field of a map value.
+func (s *maxSizeGen) fieldPath() string {
+	var b strings.Builder
+	for i, p := range s.path {
+		if i > 0 && !strings.HasPrefix(p, "[") {
+			b.WriteByte('.')
+		}
+		b.WriteString(p)
+	}
+	return b.String()
 }
 
-func (s *maxSizeGen) gStruct(st *Struct) {
+func (s *maxSizeGen) GStruct(st *Struct) {
 	if !s.p.ok() || s.halted {
 		return
 	}
@@ -155,7 +220,9 @@ func (s *maxSizeGen) gStruct(st *Struct) {
 			if !s.p.ok() {
 				return
 			}
-			next(s, st.Fields[i].FieldElem)
+			s.path = append(s.path, st.Fields[i].FieldName)
+			Next(s, st.Fields[i].FieldElem)
+			s.path = s.path[:len(s.path)-1]
 			if s.halted {
 				return
 			}
@@ -171,7 +238,9 @@ func (s *maxSizeGen) gStruct(st *Struct) {
 			data = data[:0]
 			data = msgp.AppendString(data, st.Fields[i].FieldTag)
 			s.addConstant(strconv.Itoa(len(data)))
-			next(s, st.Fields[i].FieldElem)
+			s.path = append(s.path, st.Fields[i].FieldName)
+			Next(s, st.Fields[i].FieldElem)
+			s.path = s.path[:len(s.path)-1]
 			if s.halted {
 				return
 			}
@@ -179,26 +248,26 @@ func (s *maxSizeGen) gStruct(st *Struct) {
 	}
 }
 
-func (s *maxSizeGen) gPtr(p *Ptr) {
+func (s *maxSizeGen) GPtr(p *Ptr) {
 	if !s.p.ok() || s.halted {
 		return
 	}
 	s.state = addM // inner must use add
-	next(s, p.Value)
+	Next(s, p.Value)
 	if s.halted {
 		return
 	}
 	s.state = addM // closing block; reset to add
 }
 
-func (s *maxSizeGen) gSlice(sl *Slice) {
+func (s *maxSizeGen) GSlice(sl *Slice) {
 	if !s.p.ok() || s.halted {
 		return
 	}
 	s.state = addM
 	s.p.comment("Calculating size of slice: " + sl.Varname())
 	if (sl.AllocBound() == "" || sl.AllocBound() == "-") && (sl.MaxTotalBytes() == "" || sl.MaxTotalBytes() == "-") {
-		s.panicf("Slice %s is unbounded", sl.Varname())
+		s.unbounded(sl, noBound("slice"))
 		return
 	}
 
@@ -219,16 +288,19 @@ func (s *maxSizeGen) gSlice(sl *Slice) {
 		topLevelAllocBound = sl.AllocBound()[:splitIndex]
 	}
 
-	if str, err := maxSizeExpr(childElement); err == nil {
+	n := len(s.path)
+	s.path = append(s.path, "[]")
+	if str, err := s.maxSizeExpr(childElement); err == nil {
 		s.addConstant(fmt.Sprintf("((%s) * (%s))", topLevelAllocBound, str))
 	} else {
-		s.panicf("Unable to determine max size: %v", err)
+		s.unbounded(sl, err)
 	}
+	s.path = s.path[:n]
 	s.state = addM
 	return
 }
 
-func (s *maxSizeGen) gArray(a *Array) {
+func (s *maxSizeGen) GArray(a *Array) {
 	if !s.p.ok() || s.halted {
 		return
 	}
@@ -241,17 +313,16 @@ func (s *maxSizeGen) gArray(a *Array) {
 
 	s.addConstant(builtinSize(arrayHeader))
 
-	if str, err := maxSizeExpr(a.Els); err == nil {
+	if str, err := s.maxSizeExpr(a.Els); err == nil {
 		s.addConstant(fmt.Sprintf("((%s) * (%s))", a.Size, str))
 	} else {
-		s.panicf("Unable to determine max size: %v", err)
-
+		s.unbounded(a, err)
 	}
 	s.state = addM
 	return
 }
 
-func (s *maxSizeGen) gMap(m *Map) {
+func (s *maxSizeGen) GMap(m *Map) {
 	if !s.p.ok() || s.halted {
 		return
 	}
@@ -259,8 +330,8 @@ func (s *maxSizeGen) gMap(m *Map) {
 	s.state = addM
 	s.addConstant(builtinSize(mapHeader))
 	topLevelAllocBound := m.AllocBound()
-	if topLevelAllocBound != "" && topLevelAllocBound == "-" {
-		s.panicf("Map %s is unbounded", m.Varname())
+	if topLevelAllocBound == "" || topLevelAllocBound == "-" {
+		s.unbounded(m, noBound("map"))
 		return
 	}
 	splitBounds := strings.Split(m.AllocBound(), ",")
@@ -275,7 +346,9 @@ func (s *maxSizeGen) gMap(m *Map) {
 	s.p.comment("Adding size of map keys for " + vn)
 	s.p.printf("\ns += %s", topLevelAllocBound)
 	s.state = multM
-	next(s, m.Key)
+	s.path = append(s.path, "[key]")
+	Next(s, m.Key)
+	s.path = s.path[:len(s.path)-1]
 	if s.halted {
 		return
 	}
@@ -283,7 +356,9 @@ func (s *maxSizeGen) gMap(m *Map) {
 	s.p.comment("Adding size of map values for " + vn)
 	s.p.printf("\ns += %s", topLevelAllocBound)
 	s.state = multM
-	next(s, m.Value)
+	s.path = append(s.path, "[value]")
+	Next(s, m.Value)
+	s.path = s.path[:len(s.path)-1]
 	if s.halted {
 		return
 	}
@@ -291,7 +366,7 @@ func (s *maxSizeGen) gMap(m *Map) {
 	s.state = addM
 }
 
-func (s *maxSizeGen) gBase(b *BaseElem) {
+func (s *maxSizeGen) GBase(b *BaseElem) {
 	if !s.p.ok() || s.halted {
 		return
 	}
@@ -302,55 +377,58 @@ func (s *maxSizeGen) gBase(b *BaseElem) {
 		s.state = addM
 		return
 	}
+	if b.TypeParamPtr != "" {
+		s.unbounded(b, fmt.Errorf("type parameter %s is unbounded", b.TypeName()))
+		return
+	}
 	if b.Convert && b.ShimMode == Convert {
 		s.state = addM
-		vname := randIdent()
+		vname := s.p.randIdent()
 		s.p.printf("\nvar %s %s", vname, b.BaseType())
 
 		// ensure we don't get "unused variable" warnings from outer slice iterations
 		s.p.printf("\n_ = %s", b.Varname())
 
-		value, err := baseMaxSizeExpr(b.Value, vname, b.BaseName(), b.TypeName(), b.common.AllocBound())
+		value, err := s.baseMaxSizeExpr(b.Value, b.BaseName(), b.TypeName(), b.common.AllocBound())
 		if err != nil {
-			s.panicf("Unable to determine max size: %v", err)
+			s.unbounded(b, err)
 			return
 		}
 		s.p.printf("\ns += %s", value)
 		s.state = exprM
 
 	} else {
-		vname := b.Varname()
-		if b.Convert {
-			vname = tobaseConvert(b)
-		}
-		value, err := baseMaxSizeExpr(b.Value, vname, b.BaseName(), b.TypeName(), b.common.AllocBound())
+		value, err := s.baseMaxSizeExpr(b.Value, b.BaseName(), b.TypeName(), b.common.AllocBound())
 		if err != nil {
-			s.panicf("Unable to determine max size: %v", err)
+			s.unbounded(b, err)
 			return
 		}
 		s.addConstant(value)
 	}
 }
 
-func baseMaxSizeExpr(value Primitive, vname, basename, typename string, allocbound string) (string, error) {
+func (s *maxSizeGen) baseMaxSizeExpr(value Primitive, basename, typename string, allocbound string) (string, error) {
 	if typename == "msgp.Raw" {
-		return "", fmt.Errorf("MaxSize() not implemented for Raw type")
+		return "", fmt.Errorf("msgp.Raw has no bounded size")
 	}
 	switch value {
 	case Ext:
-		return "", fmt.Errorf("MaxSize() not implemented for Ext type")
+		return "", fmt.Errorf("extension %s has no bounded size", typename)
 	case Intf:
-		return "", fmt.Errorf("MaxSize() not implemented for Interfaces")
+		return "", fmt.Errorf("interface %s has no bounded size", typename)
 	case IDENT:
+		if s.p.state.reg.isUnbounded(typename) {
+			return "", fmt.Errorf("type %s is unbounded", typename)
+		}
 		return getMaxSizeMethod(typename), nil
 	case Bytes:
 		if allocbound == "" || allocbound == "-" {
-			return "", fmt.Errorf("Byteslice type %s is unbounded", vname)
+			return "", noBound("byte slice")
 		}
 		return "msgp.BytesPrefixSize + " + allocbound, nil
 	case String:
 		if allocbound == "" || allocbound == "-" {
-			return "", fmt.Errorf("String type %s is unbounded", vname)
+			return "", noBound("string")
 		}
 		return "msgp.StringPrefixSize +  " + allocbound, nil
 	default:
@@ -360,11 +438,12 @@ func baseMaxSizeExpr(value Primitive, vname, basename, typename string, allocbou
 
 // return a fixed-size expression, if possible.
 // only possible for *BaseElem, *Array and Struct.
-// returns (expr, err)
-func maxSizeExpr(e Elem) (string, error) {
+// returns (expr, err); on error, s.path ends at
+// the unbounded element.
+func (s *maxSizeGen) maxSizeExpr(e Elem) (string, error) {
 	switch e := e.(type) {
 	case *Array:
-		if str, err := maxSizeExpr(e.Els); err == nil {
+		if str, err := s.maxSizeExpr(e.Els); err == nil {
 			return fmt.Sprintf("(%s * (%s))", e.Size, str), nil
 		} else {
 			return "", err
@@ -373,17 +452,23 @@ func maxSizeExpr(e Elem) (string, error) {
 		if fixedSize(e.Value) {
 			return builtinSize(e.BaseName()), nil
 		} else if (e.TypeName()) == "msgp.Raw" {
-			return "", fmt.Errorf("Raw type is unbounded")
+			return "", fmt.Errorf("msgp.Raw has no bounded size")
 		} else if (e.Value) == String {
 			if e.AllocBound() == "" || e.AllocBound() == "-" {
-				return "", fmt.Errorf("String type is unbounded for %s", e.Varname())
+				return "", noBound("string")
 			}
 			return fmt.Sprintf("(msgp.StringPrefixSize + %s)", e.AllocBound()), nil
 		} else if (e.Value) == IDENT {
+			if e.TypeParamPtr != "" {
+				return "", fmt.Errorf("type parameter %s is unbounded", e.TypeName())
+			}
+			if s.p.state.reg.isUnbounded(e.TypeName()) {
+				return "", fmt.Errorf("type %s is unbounded", e.TypeName())
+			}
 			return fmt.Sprintf("(%s)", getMaxSizeMethod(e.TypeName())), nil
 		} else if (e.Value) == Bytes {
 			if e.AllocBound() == "" || e.AllocBound() == "-" {
-				return "", fmt.Errorf("Inner byteslice type is unbounded")
+				return "", noBound("byte slice")
 			}
 			return fmt.Sprintf("(msgp.BytesPrefixSize + %s)", e.AllocBound()), nil
 		}
@@ -391,9 +476,11 @@ func maxSizeExpr(e Elem) (string, error) {
 		return fmt.Sprintf("(%s)", getMaxSizeMethod(e.TypeName())), nil
 	case *Slice:
 		if e.AllocBound() == "" || e.AllocBound() == "-" {
-			return "", fmt.Errorf("Slice %s is unbounded", e.Varname())
+			return "", noBound("slice")
 		}
-		if str, err := maxSizeExpr(e.Els); err == nil {
+		s.path = append(s.path, "[]")
+		if str, err := s.maxSizeExpr(e.Els); err == nil {
+			s.path = s.path[:len(s.path)-1]
 			return fmt.Sprintf("(%s * (%s))", e.AllocBound(), str), nil
 		} else {
 			return "", err
@@ -402,7 +489,31 @@ func maxSizeExpr(e Elem) (string, error) {
 	return fmt.Sprintf("%s, %s", e.TypeName(), reflect.TypeOf(e)), nil
 }
 
+// getMaxSizeDecl returns the declaration of the MaxSize
+// function of p, named by method, including the type
+// parameters of a generic type.
+func getMaxSizeDecl(p Elem, method func(string) string) string {
+	if tp := p.TypeParams(); tp != nil {
+		return method(strings.TrimSuffix(p.TypeName(), tp.Names) + tp.Decl)
+	}
+	return method(p.TypeName())
+}
+
 func getMaxSizeMethod(typeName string) (s string) {
+	return maxSizeCall(typeName, "MaxSize")
+}
+
+func getMaxSizeCheckedMethod(typeName string) (s string) {
+	return maxSizeCall(typeName, "MaxSizeChecked")
+}
+
+func maxSizeCall(typeName, suffix string) string {
+	// the type arguments of a generic type, as in
+	// Pair[A, B], go to the function: PairMaxSize[A, B]()
+	var typeArgs string
+	if i := strings.Index(typeName, "["); i != -1 {
+		typeName, typeArgs = typeName[:i], typeName[i:]
+	}
 	var pos int
 	dotIndex := strings.Index(typeName, ".")
 	if dotIndex != -1 {
@@ -410,5 +521,23 @@ func getMaxSizeMethod(typeName string) (s string) {
 	}
 	b := []byte(typeName)
 	b[pos] = bytes.ToUpper(b)[pos]
-	return string(b) + "MaxSize()"
+	return string(b) + suffix + typeArgs + "()"
+}
+
+// maxSizeExpr returns an expression of the maximum size
+// of typeName and whether it is bounded, for the tests.
+func (r *Registry) maxSizeExpr(typeName string) string {
+	if r.isUnbounded(typeName) {
+		return getMaxSizeCheckedMethod(typeName)
+	}
+	return getMaxSizeMethod(typeName) + ", true"
+}
+
+// baseTypeName strips the type arguments
+// from the name of a generic type.
+func baseTypeName(typeName string) string {
+	if i := strings.Index(typeName, "["); i != -1 {
+		return typeName[:i]
+	}
+	return typeName
 }
@@ -0,0 +1,237 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"strings"
+)
+
+func randomizes(w io.Writer, topics *Topics, st *printState) *randomizeGen {
+	return &randomizeGen{
+		p:      printer{w: w, state: st},
+		topics: topics,
+	}
+}
+
+// randomizeGen emits RandomizeMsg methods, which fill the
+// encoded fields of a value with random data that decodes
+// without error: slices, maps, strings and byte slices
+// stay within their allocbound.
+//
+// Slices, maps and pointers are left nil once maxDepth
+// is exhausted, so that recursive types terminate.
+type randomizeGen struct {
+	Passes
+	p      printer
+	ctx    *Context
+	msgs   []Diagnostic
+	topics *Topics
+}
+
+func (r *randomizeGen) Method() Method { return Randomize }
+
+func (r *randomizeGen) Apply(dirs []string) error {
+	return nil
+}
+
+func (r *randomizeGen) Execute(p Elem) ([]Diagnostic, error) {
+	r.msgs = nil
+	if !r.p.ok() {
+		return r.msgs, r.p.err
+	}
+	p = r.ApplyAll(p)
+	if p == nil {
+		return r.msgs, nil
+	}
+
+	// We might change p.Varname in MethodReceiver(); make a copy
+	// to not affect other code that will use p.
+	p = p.Copy()
+
+	r.ctx = &Context{}
+
+	r.p.comment("RandomizeMsg fills the encoded fields of this value with random data, nesting at most maxDepth levels")
+
+	if IsDangling(p) {
+		baseType := p.(*BaseElem).IdentName
+		ptrName := p.Varname()
+		receiver := MethodReceiver(p)
+		r.p.printf("\nfunc (%s %s) RandomizeMsg(r *rand.Rand, maxDepth int) {", ptrName, receiver)
+		r.p.printf("\n  ((*(%s))(%s)).RandomizeMsg(r, maxDepth)", baseType, ptrName)
+		r.p.printf("\n}")
+		r.topics.Add(receiver, "RandomizeMsg")
+		return r.msgs, r.p.err
+	}
+
+	ptrName := p.Varname()
+	receiver := MethodReceiver(p)
+	r.p.printf("\nfunc (%s %s) RandomizeMsg(r *rand.Rand, maxDepth int) {", ptrName, receiver)
+	Next(r, p)
+	r.p.nakedReturn()
+
+	r.topics.Add(receiver, "RandomizeMsg")
+	return r.msgs, r.p.err
+}
+
+// randomBound returns the bound argument of the msgp.Random*
+// helpers for the given allocbound.
+func randomBound(bound string) string {
+	if bound == "" || bound == "-" {
+		return "-1"
+	}
+	return "int(" + bound + ")"
+}
+
+// leaves nil, once maxDepth is exhausted or by chance,
+// the container vn and opens the block that fills it
+func (r *randomizeGen) openContainer(vn string) {
+	r.p.printf("\nif maxDepth <= 0 || r.Intn(4) == 0 {")
+	r.p.printf("\n%s = nil", vn)
+	r.p.printf("\n} else {")
+}
+
+func (r *randomizeGen) GStruct(s *Struct) {
+	if !r.p.ok() {
+		return
+	}
+	for i := range s.Fields {
+		if !ast.IsExported(s.Fields[i].FieldName) {
+			continue
+		}
+		r.ctx.PushString(s.Fields[i].FieldName)
+		Next(r, s.Fields[i].FieldElem)
+		r.ctx.Pop()
+	}
+}
+
+func (r *randomizeGen) GSlice(s *Slice) {
+	if !r.p.ok() {
+		return
+	}
+	bound := strings.Split(s.AllocBound(), ",")[0]
+	childElement := s.Els
+	if s.Els.AllocBound() == "" && len(strings.Split(s.AllocBound(), ",")) > 1 {
+		childElement = s.Els.Copy()
+		childElement.SetAllocBound(s.AllocBound()[strings.Index(s.AllocBound(), ",")+1:])
+	}
+	r.openContainer(s.Varname())
+	r.p.printf("\n%s = make(%s, msgp.RandomLen(r, %s))", s.Varname(), s.TypeName(), randomBound(bound))
+	r.p.rangeBlock(r.ctx, s.Index, s.Varname(), r, childElement)
+	r.p.closeblock()
+}
+
+func (r *randomizeGen) GArray(a *Array) {
+	if !r.p.ok() {
+		return
+	}
+	r.p.rangeBlock(r.ctx, a.Index, a.Varname(), r, a.Els)
+}
+
+func (r *randomizeGen) GMap(m *Map) {
+	if !r.p.ok() {
+		return
+	}
+	splitBounds := strings.Split(m.AllocBound(), ",")
+	key, value := m.Key, m.Value
+	if len(splitBounds) > 1 {
+		key = m.Key.Copy()
+		key.SetAllocBound(splitBounds[1])
+		if len(splitBounds) > 2 {
+			value = m.Value.Copy()
+			value.SetAllocBound(splitBounds[2])
+		}
+	}
+	sz := r.p.randIdent()
+	r.openContainer(m.Varname())
+	r.p.printf("\n%s := msgp.RandomLen(r, %s)", sz, randomBound(splitBounds[0]))
+	r.p.printf("\n%s = make(%s, %s)", m.Varname(), m.TypeName(), sz)
+	r.p.printf("\nfor ; %s > 0; %s-- {", sz, sz)
+	r.p.printf("\nvar %s %s; var %s %s", m.Keyidx, m.Key.TypeName(), m.Validx, m.Value.TypeName())
+	Next(r, key)
+	r.ctx.PushVar(m.Keyidx)
+	Next(r, value)
+	r.ctx.Pop()
+	r.p.mapAssign(m)
+	r.p.closeblock()
+	r.p.closeblock()
+}
+
+func (r *randomizeGen) GPtr(p *Ptr) {
+	if !r.p.ok() {
+		return
+	}
+	r.openContainer(p.Varname())
+	r.p.printf("\n%s = new(%s)", p.Varname(), p.Value.TypeName())
+	Next(r, p.Value)
+	r.p.closeblock()
+}
+
+func (r *randomizeGen) GBase(b *BaseElem) {
+	if !r.p.ok() {
+		return
+	}
+	vn := stripRef(b.Varname())
+
+	if b.Convert && b.ShimMode == Convert {
+		// the shim may reject random values, so
+		// such fields keep their zero value
+		return
+	}
+
+	var expr string
+	switch b.Value {
+	case IDENT:
+		if b.TypeParamPtr != "" {
+			// RandomizeMsg is not part of msgp.Msg
+			r.p.printf("\nif v, ok := any(%s).(msgp.Randomizer); ok {", vn)
+			r.p.printf("\nv.RandomizeMsg(r, maxDepth-1)")
+			r.p.closeblock()
+			return
+		}
+		if name, _, _ := strings.Cut(b.TypeName(), "["); strings.Contains(name, ".") {
+			// the RandomizeMsg of a type of another package is
+			// only exported if it was generated with -randomize
+			ref := "&" + vn
+			if b.ptrVarname && !b.Convert {
+				ref = vn
+			}
+			r.p.printf("\nif v, ok := interface{}(%s).(msgp.Randomizer); ok {", ref)
+			r.p.printf("\nv.RandomizeMsg(r, maxDepth-1)")
+			r.p.closeblock()
+			return
+		}
+		r.p.printf("\n%s.RandomizeMsg(r, maxDepth-1)", vn)
+		return
+	case Intf, Ext, Error:
+		// there is no random value that is
+		// known to decode into these
+		return
+	case Bytes:
+		expr = fmt.Sprintf("msgp.RandomBytes(r, %s)", randomBound(b.AllocBound()))
+	case String:
+		expr = fmt.Sprintf("msgp.RandomString(r, %s)", randomBound(b.AllocBound()))
+	case Bool:
+		expr = "msgp.RandomBool(r)"
+	case Float32:
+		expr = "float32(msgp.RandomFloat64(r))"
+	case Float64:
+		expr = "msgp.RandomFloat64(r)"
+	case Complex64:
+		expr = "complex64(complex(msgp.RandomFloat64(r), msgp.RandomFloat64(r)))"
+	case Complex128:
+		expr = "complex(msgp.RandomFloat64(r), msgp.RandomFloat64(r))"
+	case Time:
+		expr = "msgp.RandomTime(r)"
+	case Duration:
+		expr = "time.Duration(msgp.RandomInt64(r))"
+	case Int, Int8, Int16, Int32, Int64:
+		expr = fmt.Sprintf("%s(msgp.RandomInt64(r))", b.BaseType())
+	default:
+		expr = fmt.Sprintf("%s(msgp.RandomUint64(r))", b.BaseType())
+	}
+	if b.Convert {
+		expr = fmt.Sprintf("%s(%s)", b.FromBase(), expr)
+	}
+	r.p.printf("\n%s = %s", vn, expr)
+}
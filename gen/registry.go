@@ -0,0 +1,76 @@
+package gen
+
+// A Registry holds the types registered by the msgp:sort and
+// msgp:unbounded directives. Types registered in one package
+// affect the types of every package that refers to them, so
+// the packages generated together share a Registry. A nil
+// Registry has no types registered.
+type Registry struct {
+	sortIntfs map[string]string
+	unbounded map[string]bool
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		sortIntfs: make(map[string]string),
+		unbounded: make(map[string]bool),
+	}
+}
+
+// SetSortInterface registers sortintf as the sort.Interface
+// for slices of sorttype, from the msgp:sort directive. It
+// would have been nice to register it inside the Elem, but
+// unfortunately that only affects the type definition; call
+// sites that refer to that type (e.g., map keys) have a
+// different Elem that does not inherit (get copied) from
+// the type definition in f.Identities.
+func (r *Registry) SetSortInterface(sorttype string, sortintf string) {
+	r.sortIntfs[sorttype] = sortintf
+}
+
+// SetUnbounded marks the type name as intentionally
+// unbounded, generating MaxSizeChecked for it instead
+// of MaxSize.
+func (r *Registry) SetUnbounded(typeName string) {
+	r.unbounded[typeName] = true
+}
+
+func (r *Registry) sortInterface(typeName string) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+	intf, ok := r.sortIntfs[typeName]
+	return intf, ok
+}
+
+func (r *Registry) isUnbounded(typeName string) bool {
+	return r != nil && r.unbounded[baseTypeName(typeName)]
+}
+
+// printState is the state of a Printer, shared by its
+// generators and by the Elems it prints.
+type printState struct {
+	ids identGen
+	reg *Registry
+}
+
+// attach sets the printState of e and of its children.
+func attach(e Elem, st *printState) {
+	e.setState(st)
+	switch e := e.(type) {
+	case *Struct:
+		for i := range e.Fields {
+			attach(e.Fields[i].FieldElem, st)
+		}
+	case *Array:
+		attach(e.Els, st)
+	case *Slice:
+		attach(e.Els, st)
+	case *Map:
+		attach(e.Key, st)
+		attach(e.Value, st)
+	case *Ptr:
+		attach(e.Value, st)
+	}
+}
@@ -0,0 +1,195 @@
+package gen
+
+import (
+	"go/ast"
+	"sort"
+	"strings"
+)
+
+// A Schema describes the wire encoding of the types of
+// a package. It is stable: it only depends on the types,
+// and serializes to the same JSON for the same types.
+type Schema struct {
+	Package string            `json:"package"`
+	Types   map[string]*Shape `json:"types"`
+}
+
+// Kinds of Shape.
+const (
+	KindStruct    = "struct"    // a struct encoded as a map of its field tags
+	KindTuple     = "tuple"     // a struct encoded as an array of its fields
+	KindArray     = "array"     // an array of Size elements
+	KindSlice     = "slice"     // an array of elements
+	KindMap       = "map"       // a map of keys to values
+	KindPtr       = "ptr"       // nil, or the element
+	KindPrimitive = "primitive" // a string, number, time, []byte, etc.
+	KindExt       = "ext"       // a msgp extension
+	KindNamed     = "named"     // a type of the schema, or of another package
+)
+
+// A Shape describes how the values of an Elem are encoded.
+type Shape struct {
+	Kind string `json:"kind"`
+
+	// Type is the Go type, if it is named or
+	// differs from the encoded primitive.
+	Type string `json:"type,omitempty"`
+
+	// Primitive is the primitive encoded by KindPrimitive,
+	// spelled as in Go, e.g. "uint64", "[]byte" or "time.Time".
+	Primitive string `json:"primitive,omitempty"`
+
+	// Ref is the type referenced by KindNamed.
+	Ref string `json:"ref,omitempty"`
+
+	// Size is the length of KindArray.
+	Size string `json:"size,omitempty"`
+
+	Elem  *Shape `json:"elem,omitempty"`  // of arrays, slices and pointers
+	Key   *Shape `json:"key,omitempty"`   // of maps
+	Value *Shape `json:"value,omitempty"` // of maps
+
+	// Fields of structs, sorted by tag, and
+	// of tuples, in the order they are encoded.
+	Fields []Field `json:"fields,omitempty"`
+
+	// AllocBound and MaxTotalBytes are the Go expressions
+	// bounding the number of elements, or of bytes, decoded.
+	// An AllocBound of "-" means unbounded on purpose.
+	AllocBound    string `json:"allocbound,omitempty"`
+	MaxTotalBytes string `json:"maxtotalbytes,omitempty"`
+
+	// Shim converts the Go type to and from the primitive.
+	Shim *Shim `json:"shim,omitempty"`
+}
+
+// A Field is an encoded field of a struct.
+type Field struct {
+	Tag       string   `json:"tag"`
+	Name      string   `json:"name"`
+	OmitEmpty bool     `json:"omitempty,omitempty"`
+	Since     string   `json:"since,omitempty"`
+	Until     string   `json:"until,omitempty"`
+	Aliases   []string `json:"aliases,omitempty"`
+	Shape     *Shape   `json:"shape"`
+}
+
+// A Shim is a //msgp:shim of a Shape.
+type Shim struct {
+	ToBase   string `json:"tobase"`
+	FromBase string `json:"frombase"`
+	Mode     string `json:"mode"`
+}
+
+// NewSchema returns the Schema of package pkg for the
+// identities of a file set. Structs without codec tags
+// are not encoded, and are left out.
+func NewSchema(pkg string, identities map[string]Elem) *Schema {
+	s := &Schema{Package: pkg, Types: make(map[string]*Shape)}
+	for name, e := range identities {
+		if st, ok := e.(*Struct); ok && !st.HasAnyStructTag() {
+			continue
+		}
+		s.Types[name] = ShapeOf(e)
+	}
+	return s
+}
+
+// ShapeOf returns the Shape of e.
+func ShapeOf(e Elem) *Shape {
+	return shapeOf(e, "")
+}
+
+// shapeOf returns the Shape of e, whose allocbound is
+// bound unless e has an allocbound of its own. Bounds
+// after the first comma bound the elements of e.
+func shapeOf(e Elem, bound string) *Shape {
+	if e.AllocBound() != "" {
+		bound = e.AllocBound()
+	}
+	bounds := strings.Split(bound, ",")
+	nth := func(i int) string {
+		if i < len(bounds) {
+			return bounds[i]
+		}
+		return ""
+	}
+	sh := &Shape{MaxTotalBytes: e.MaxTotalBytes()}
+
+	switch e := e.(type) {
+	case *Struct:
+		sh.Kind = KindStruct
+		if e.AsTuple {
+			sh.Kind = KindTuple
+		}
+		sh.Fields = structFields(e)
+	case *Array:
+		sh.Kind = KindArray
+		sh.Size = e.Size
+		sh.Elem = shapeOf(e.Els, bound)
+	case *Slice:
+		sh.Kind = KindSlice
+		sh.AllocBound = nth(0)
+		sh.Elem = shapeOf(e.Els, strings.Join(bounds[1:], ","))
+	case *Map:
+		sh.Kind = KindMap
+		sh.AllocBound = nth(0)
+		sh.Key = shapeOf(e.Key, nth(1))
+		sh.Value = shapeOf(e.Value, nth(2))
+	case *Ptr:
+		sh.Kind = KindPtr
+		sh.Elem = shapeOf(e.Value, bound)
+	case *BaseElem:
+		switch e.Value {
+		case IDENT:
+			sh.Kind = KindNamed
+			sh.Ref = e.TypeName()
+			sh.AllocBound = bound
+		case Ext:
+			sh.Kind = KindExt
+			sh.Type = e.TypeName()
+		default:
+			sh.Kind = KindPrimitive
+			sh.Primitive = e.BaseType()
+			if e.Value == String || e.Value == Bytes {
+				sh.AllocBound = nth(0)
+			}
+			if e.Convert {
+				sh.Type = e.TypeName()
+			}
+			if e.ShimToBase != "" {
+				mode := "cast"
+				if e.ShimMode == Convert {
+					mode = "convert"
+				}
+				sh.Shim = &Shim{ToBase: e.ShimToBase, FromBase: e.ShimFromBase, Mode: mode}
+			}
+		}
+	}
+	return sh
+}
+
+// structFields returns the encoded fields of s:
+// the exported fields, sorted by tag, or every
+// field in order if s is a tuple.
+func structFields(s *Struct) []Field {
+	fields := make([]Field, 0, len(s.Fields))
+	for _, sf := range s.Fields {
+		if !s.AsTuple && !ast.IsExported(sf.FieldName) {
+			continue
+		}
+		fields = append(fields, Field{
+			Tag:       sf.FieldTag,
+			Name:      sf.FieldName,
+			OmitEmpty: !s.AsTuple && isFieldOmitEmpty(sf, s),
+			Since:     sf.Since,
+			Until:     sf.Until,
+			Aliases:   sf.Aliases,
+			Shape:     shapeOf(sf.FieldElem, ""),
+		})
+	}
+	if !s.AsTuple {
+		sort.SliceStable(fields, func(i, j int) bool { return fields[i].Tag < fields[j].Tag })
+	}
+	return fields
+}
@@ -22,16 +22,16 @@ const (
 	expr
 )
 
-func sizes(w io.Writer, topics *Topics) *sizeGen {
+func sizes(w io.Writer, topics *Topics, st *printState) *sizeGen {
 	return &sizeGen{
-		p:      printer{w: w},
+		p:      printer{w: w, state: st},
 		state:  assign,
 		topics: topics,
 	}
 }
 
 type sizeGen struct {
-	passes
+	Passes
 	p      printer
 	state  sizeState
 	ctx    *Context
@@ -72,16 +72,16 @@ func (s *sizeGen) addConstant(sz string) {
 	panic("unknown size state")
 }
 
-func (s *sizeGen) Execute(p Elem) ([]string, error) {
+func (s *sizeGen) Execute(p Elem) ([]Diagnostic, error) {
 	if !s.p.ok() {
 		return nil, s.p.err
 	}
-	p = s.applyall(p)
+	p = s.ApplyAll(p)
 	if p == nil {
 		return nil, nil
 	}
 
-	// We might change p.Varname in methodReceiver(); make a copy
+	// We might change p.Varname in MethodReceiver(); make a copy
 	// to not affect other code that will use p.
 	p = p.Copy()
 
@@ -90,7 +90,7 @@ func (s *sizeGen) Execute(p Elem) ([]string, error) {
 	if IsDangling(p) {
 		baseType := p.(*BaseElem).IdentName
 		ptrName := p.Varname()
-		receiver := methodReceiver(p)
+		receiver := MethodReceiver(p)
 		s.p.printf("\nfunc (%s %s) Msgsize() int {", ptrName, receiver)
 		s.p.printf("\n  return ((*(%s))(%s)).Msgsize()", baseType, ptrName)
 		s.p.printf("\n}")
@@ -102,16 +102,16 @@ func (s *sizeGen) Execute(p Elem) ([]string, error) {
 	s.ctx.PushString(p.TypeName())
 
 	ptrName := p.Varname()
-	receiver := imutMethodReceiver(p)
+	receiver := ImutMethodReceiver(p)
 	s.p.printf("\nfunc (%s %s) Msgsize() (s int) {", ptrName, receiver)
 	s.state = assign
-	next(s, p)
+	Next(s, p)
 	s.p.nakedReturn()
 	s.topics.Add(receiver, "Msgsize")
 	return nil, s.p.err
 }
 
-func (s *sizeGen) gStruct(st *Struct) {
+func (s *sizeGen) GStruct(st *Struct) {
 	if !s.p.ok() {
 		return
 	}
@@ -134,7 +134,7 @@ func (s *sizeGen) gStruct(st *Struct) {
 			if !s.p.ok() {
 				return
 			}
-			next(s, st.Fields[i].FieldElem)
+			Next(s, st.Fields[i].FieldElem)
 		}
 	} else {
 		data := msgp.AppendMapHeader(nil, nfields)
@@ -147,20 +147,20 @@ func (s *sizeGen) gStruct(st *Struct) {
 			data = data[:0]
 			data = msgp.AppendString(data, st.Fields[i].FieldTag)
 			s.addConstant(strconv.Itoa(len(data)))
-			next(s, st.Fields[i].FieldElem)
+			Next(s, st.Fields[i].FieldElem)
 		}
 	}
 }
 
-func (s *sizeGen) gPtr(p *Ptr) {
+func (s *sizeGen) GPtr(p *Ptr) {
 	s.state = add // inner must use add
 	s.p.printf("\nif %s == nil {\ns += msgp.NilSize\n} else {", p.Varname())
-	next(s, p.Value)
+	Next(s, p.Value)
 	s.state = add // closing block; reset to add
 	s.p.closeblock()
 }
 
-func (s *sizeGen) gSlice(sl *Slice) {
+func (s *sizeGen) GSlice(sl *Slice) {
 	if !s.p.ok() {
 		return
 	}
@@ -181,7 +181,7 @@ func (s *sizeGen) gSlice(sl *Slice) {
 	s.state = add
 }
 
-func (s *sizeGen) gArray(a *Array) {
+func (s *sizeGen) GArray(a *Array) {
 	if !s.p.ok() {
 		return
 	}
@@ -201,7 +201,7 @@ func (s *sizeGen) gArray(a *Array) {
 	s.state = add
 }
 
-func (s *sizeGen) gMap(m *Map) {
+func (s *sizeGen) GMap(m *Map) {
 	s.addConstant(builtinSize(mapHeader))
 	vn := m.Varname()
 	s.p.printf("\nif %s != nil {", vn)
@@ -211,21 +211,21 @@ func (s *sizeGen) gMap(m *Map) {
 	s.p.printf("\ns += 0")
 	s.state = expr
 	s.ctx.PushVar(m.Keyidx)
-	next(s, m.Key)
-	next(s, m.Value)
+	Next(s, m.Key)
+	Next(s, m.Value)
 	s.ctx.Pop()
 	s.p.closeblock()
 	s.p.closeblock()
 	s.state = add
 }
 
-func (s *sizeGen) gBase(b *BaseElem) {
+func (s *sizeGen) GBase(b *BaseElem) {
 	if !s.p.ok() {
 		return
 	}
 	if b.Convert && b.ShimMode == Convert {
 		s.state = add
-		vname := randIdent()
+		vname := s.p.randIdent()
 		s.p.printf("\nvar %s %s", vname, b.BaseType())
 
 		// ensure we don't get "unused variable" warnings from outer slice iterations
@@ -3,8 +3,10 @@ package gen
 import (
 	"bytes"
 	"fmt"
+	"go/token"
 	"io"
 	"strings"
+	"text/template"
 )
 
 const (
@@ -21,7 +23,7 @@ const (
 
 // Method is a bitfield representing something that the
 // generator knows how to print.
-type Method uint8
+type Method uint16
 
 // are the bits in 'f' set in 'm'?
 func (m Method) isset(f Method) bool { return (m&f == f) }
@@ -41,11 +43,21 @@ func (m Method) String() string {
 		return "iszero"
 	case MaxSize:
 		return "maxsize"
+	case Copy:
+		return "copy"
+	case Equal:
+		return "equal"
+	case Randomize:
+		return "randomize"
 	case Test:
 		return "test"
+	case Fuzz:
+		return "fuzz"
+	case Golden:
+		return "golden"
 	default:
 		// return e.g. "marshal+unmarshal+test"
-		modes := [...]Method{Marshal, Unmarshal, Size, IsZero, MaxSize, Test}
+		modes := [...]Method{Marshal, Unmarshal, Size, IsZero, MaxSize, Copy, Equal, Randomize, Test, Fuzz, Golden}
 		any := false
 		nm := ""
 		for _, mm := range modes {
@@ -75,55 +87,125 @@ func strtoMeth(s string) Method {
 		return IsZero
 	case "maxsize":
 		return MaxSize
+	case "copy":
+		return Copy
+	case "equal":
+		return Equal
+	case "randomize":
+		return Randomize
 	case "test":
 		return Test
+	case "fuzz":
+		return Fuzz
+	case "golden":
+		return Golden
 	default:
 		return 0
 	}
 }
 
 const (
-	Marshal     Method                       = 1 << iota // msgp.Marshaler
-	Unmarshal                                            // msgp.Unmarshaler
-	Size                                                 // msgp.Sizer
-	IsZero                                               // implement MsgIsZero()
-	Test                                                 // generate tests
-	MaxSize                                              // msgp.MaxSize
-	invalidmeth                                          // this isn't a method
-	marshaltest = Marshal | Unmarshal | Test             // tests for Marshaler and Unmarshaler
+	Marshal       Method                         = 1 << iota // msgp.Marshaler
+	Unmarshal                                                // msgp.Unmarshaler
+	Size                                                     // msgp.Sizer
+	IsZero                                                   // implement MsgIsZero()
+	Test                                                     // generate tests
+	MaxSize                                                  // msgp.MaxSize
+	Copy                                                     // implement MsgCopy()
+	Equal                                                    // implement MsgEqual()
+	Randomize                                                // implement RandomizeMsg()
+	Fuzz                                                     // generate fuzz targets
+	Golden                                                   // generate golden test vectors
+	invalidmeth                                              // this isn't a method
+	marshaltest   = Marshal | Unmarshal | Test               // tests for Marshaler and Unmarshaler
+	marshalfuzz   = Marshal | Unmarshal | Fuzz               // fuzz targets for Unmarshaler
+	marshalgolden = Marshal | Unmarshal | Golden             // golden vectors of canonical encodings
 )
 
 type Printer struct {
-	gens []generator
+	gens   []Generator
+	st     *printState
+	out    io.Writer
+	topics *Topics
 }
 
 func NewPrinter(m Method, topics *Topics, out io.Writer, tests io.Writer) *Printer {
-	if m.isset(Test) && tests == nil {
+	if (m.isset(Test) || m.isset(Fuzz) || m.isset(Golden)) && tests == nil {
 		panic("cannot print tests with 'nil' tests argument!")
 	}
-	gens := make([]generator, 0, 7)
+	st := &printState{ids: identGen{prefix: "za"}}
+	gens := make([]Generator, 0, 12)
 	if m.isset(Marshal) {
-		gens = append(gens, marshal(out, topics))
+		gens = append(gens, marshal(out, topics, st))
 	}
 	if m.isset(Unmarshal) {
-		gens = append(gens, unmarshal(out, topics))
+		gens = append(gens, unmarshal(out, topics, st))
 	}
 	if m.isset(Size) {
-		gens = append(gens, sizes(out, topics))
+		gens = append(gens, sizes(out, topics, st))
 	}
 	if m.isset(IsZero) {
-		gens = append(gens, isZeros(out, topics))
+		gens = append(gens, isZeros(out, topics, st))
 	}
 	if m.isset(MaxSize) {
-		gens = append(gens, maxSizes(out, topics))
+		gens = append(gens, maxSizes(out, topics, st))
+	}
+	if m.isset(Copy) {
+		gens = append(gens, copies(out, topics, st))
+	}
+	if m.isset(Equal) {
+		gens = append(gens, equals(out, topics, st))
+	}
+	if m.isset(Randomize) {
+		gens = append(gens, randomizes(out, topics, st))
+	} else if m.isset(marshaltest) || m.isset(marshalfuzz) || m.isset(marshalgolden) {
+		// the generated tests, fuzz targets and golden vectors
+		// rely on RandomizeMsg, which then only the tests declare
+		gens = append(gens, randomizes(tests, new(Topics), st))
 	}
 	if m.isset(marshaltest) {
-		gens = append(gens, mtest(tests))
+		gens = append(gens, mtest(tests, st))
+	}
+	if m.isset(marshalfuzz) {
+		gens = append(gens, fuzz(tests))
+	}
+	if m.isset(marshalgolden) {
+		gens = append(gens, golden(tests))
 	}
 	if len(gens) == 0 {
 		panic("NewPrinter called with invalid method flags")
 	}
-	return &Printer{gens: gens}
+	return &Printer{gens: gens, st: st, out: out, topics: topics}
+}
+
+// A Plugin returns a Generator of extra code for the types
+// printed by a Printer, such as domain-specific helpers. The
+// Generator writes its code with w, after the methods of each
+// type in the same file, and may add the methods it generates
+// to topics.
+type Plugin func(w *Writer, topics *Topics) Generator
+
+// AddPlugin adds the Generator returned by pl
+// to the generators run by p.
+func (p *Printer) AddPlugin(pl Plugin) {
+	p.gens = append(p.gens, pl(&Writer{p: printer{w: p.out, state: p.st}}, p.topics))
+}
+
+// SetRegistry sets the Registry of the types
+// registered by directives, which is shared by
+// the Printers of the packages generated together.
+func (p *Printer) SetRegistry(r *Registry) {
+	p.st.reg = r
+}
+
+// SetTestTemplate replaces the template of the
+// generated tests.
+func (p *Printer) SetTestTemplate(t *template.Template) {
+	for _, g := range p.gens {
+		if m, ok := g.(*mtestGen); ok {
+			m.templ, m.bound = t, nil
+		}
+	}
 }
 
 // TransformPass is a pass that transforms individual
@@ -138,6 +220,10 @@ func IgnoreTypename(name string) TransformPass {
 		if e.TypeName() == name {
 			return nil
 		}
+		// generic types are named without their type parameters
+		if tp := e.TypeParams(); tp != nil && strings.TrimSuffix(e.TypeName(), tp.Names) == name {
+			return nil
+		}
 		return e
 	}
 }
@@ -152,24 +238,39 @@ func (p *Printer) ApplyDirective(pass Method, t TransformPass) {
 	}
 }
 
+// A Diagnostic is a problem that prevents
+// the methods of an Elem from being generated,
+// at the position of the Elem it concerns.
+type Diagnostic struct {
+	Pos     token.Pos
+	Message string
+}
+
+// diagf returns a Diagnostic at the position of e.
+func diagf(e Elem, format string, args ...interface{}) Diagnostic {
+	return Diagnostic{Pos: e.Pos(), Message: fmt.Sprintf(format, args...)}
+}
+
 // Print prints an Elem.
-func (p *Printer) Print(e Elem) ([]string, error) {
+func (p *Printer) Print(e Elem) ([]Diagnostic, error) {
+	// Elem.SetVarname() generates identifiers as it walks the Elem. This can cause
+	// collisions between idents created during SetVarname and idents created by
+	// the generators, hence the separate prefixes.
+	attach(e, p.st)
+	e.SetVarname("z")
+
 	// If the elem is a struct and has no _struct annotations, skip it.
 	es, ok := e.(*Struct)
 	if ok && !es.HasAnyStructTag() {
 		return nil, nil
 	}
 
-	var msgs []string
+	var msgs []Diagnostic
 
 	for _, g := range p.gens {
-		// Elem.SetVarname() is called before the Print() step in parse.FileSet.PrintTo().
-		// Elem.SetVarname() generates identifiers as it walks the Elem. This can cause
-		// collisions between idents created during SetVarname and idents created during Print,
-		// hence the separate prefixes.
-		resetIdent("zb")
+		p.st.ids.reset("zb")
 		m, err := g.Execute(e)
-		resetIdent("za")
+		p.st.ids.reset("za")
 
 		if err != nil {
 			return nil, err
@@ -196,22 +297,30 @@ func (c contextVar) Arg() string {
 	return string(c)
 }
 
+// A Context is the path from a type to the element being
+// generated, such as the field names and index variables,
+// for wrapping the errors of the generated code.
 type Context struct {
 	path []contextItem
 }
 
+// PushString pushes a field name.
 func (c *Context) PushString(s string) {
 	c.path = append(c.path, contextString(s))
 }
 
+// PushVar pushes a variable, such as a slice index.
 func (c *Context) PushVar(s string) {
 	c.path = append(c.path, contextVar(s))
 }
 
+// Pop pops the last name or variable pushed.
 func (c *Context) Pop() {
 	c.path = c.path[:len(c.path)-1]
 }
 
+// ArgsStr returns the path as the arguments
+// of msgp.WrapError, after the error.
 func (c *Context) ArgsStr() string {
 	var out string
 	for idx, p := range c.path {
@@ -223,21 +332,29 @@ func (c *Context) ArgsStr() string {
 	return out
 }
 
-// generator is the interface through
-// which code is generated.
-type generator interface {
+// Generator is the interface through which code is
+// generated. Besides the built-in generators, a Printer
+// runs those added by AddPlugin.
+type Generator interface {
+	// Method returns the methods the generated code depends on;
+	// the passes of directives like //msgp:marshal ignore for
+	// any of them are added to the Generator.
 	Method() Method
 	Add(p TransformPass)
-	Execute(Elem) ([]string, error) // execute writes the method for the provided object.
+	Execute(Elem) ([]Diagnostic, error) // execute writes the method for the provided object.
 }
 
-type passes []TransformPass
+// Passes implements the Add method of a Generator;
+// Execute applies them with ApplyAll.
+type Passes []TransformPass
 
-func (p *passes) Add(t TransformPass) {
+func (p *Passes) Add(t TransformPass) {
 	*p = append(*p, t)
 }
 
-func (p *passes) applyall(e Elem) Elem {
+// ApplyAll applies the passes to e, returning
+// nil if any of them ignores it.
+func (p *Passes) ApplyAll(e Elem) Elem {
 	for _, t := range *p {
 		e = t(e)
 		if e == nil {
@@ -247,38 +364,43 @@ func (p *passes) applyall(e Elem) Elem {
 	return e
 }
 
-type traversal interface {
-	gMap(*Map)
-	gSlice(*Slice)
-	gArray(*Array)
-	gPtr(*Ptr)
-	gBase(*BaseElem)
-	gStruct(*Struct)
+// A Traversal generates code for each kind of Elem;
+// Next dispatches an Elem to it, and its methods call
+// Next on the children of the Elem.
+type Traversal interface {
+	GMap(*Map)
+	GSlice(*Slice)
+	GArray(*Array)
+	GPtr(*Ptr)
+	GBase(*BaseElem)
+	GStruct(*Struct)
 }
 
 // type-switch dispatch to the correct
 // method given the type of 'e'
-func next(t traversal, e Elem) {
+func Next(t Traversal, e Elem) {
 	switch e := e.(type) {
 	case *Map:
-		t.gMap(e)
+		t.GMap(e)
 	case *Struct:
-		t.gStruct(e)
+		t.GStruct(e)
 	case *Slice:
-		t.gSlice(e)
+		t.GSlice(e)
 	case *Array:
-		t.gArray(e)
+		t.GArray(e)
 	case *Ptr:
-		t.gPtr(e)
+		t.GPtr(e)
 	case *BaseElem:
-		t.gBase(e)
+		t.GBase(e)
 	default:
 		panic("bad element type")
 	}
 }
 
-// possibly-immutable method receiver
-func imutMethodReceiver(p Elem) string {
+// ImutMethodReceiver returns the receiver type of the methods
+// of p that leave it unmodified: for large types, a pointer,
+// through which it dereferences the Varname of p.
+func ImutMethodReceiver(p Elem) string {
 	switch e := p.(type) {
 	case *Struct:
 		// TODO(HACK): actually do real math here.
@@ -306,18 +428,97 @@ func imutMethodReceiver(p Elem) string {
 	}
 }
 
-// if necessary, wraps a type
-// so that its method receiver
-// is of the write type.
-func methodReceiver(p Elem) string {
+// MethodReceiver returns the pointer receiver type of
+// the methods of p, and dereferences its Varname.
+func MethodReceiver(p Elem) string {
 	p.SetVarname("(*" + p.Varname() + ")")
 	return "*" + p.TypeName()
 }
 
+// varMap derives the name of a variable in a second
+// value from the name of the matching variable in the
+// value being traversed, for generators that walk two
+// values at once.
+type varMap []varPair
+
+type varPair struct {
+	from string
+	to   string
+}
+
+func (v *varMap) push(from string, to string) {
+	*v = append(*v, varPair{from: from, to: to})
+}
+
+func (v *varMap) pop() {
+	*v = (*v)[:len(*v)-1]
+}
+
+// name translates a variable name.
+func (v varMap) name(s string) string {
+	for i := len(v) - 1; i >= 0; i-- {
+		if out, ok := replaceVar(s, v[i].from, v[i].to, 1); ok {
+			return out
+		}
+	}
+	panic(fmt.Sprintf("no matching variable for %s", s))
+}
+
+// expr translates every variable in an expression,
+// such as one returned by IfZeroExpr.
+func (v varMap) expr(s string) string {
+	for i := len(v) - 1; i >= 0; i-- {
+		if out, ok := replaceVar(s, v[i].from, v[i].to, -1); ok {
+			return out
+		}
+	}
+	panic(fmt.Sprintf("no matching variable for %s", s))
+}
+
+// replaceVar replaces the first n uses (all, if n < 0) of
+// the variable from in the expression s, skipping longer
+// identifiers that contain it, such as za00010 for za0001,
+// and fields of the same name, such as z.za0001.
+func replaceVar(s string, from string, to string, n int) (string, bool) {
+	var out strings.Builder
+	found, i := 0, 0
+	for found != n {
+		j := strings.Index(s[i:], from)
+		if j < 0 {
+			break
+		}
+		j += i
+		end := j + len(from)
+		if (j > 0 && (isIdentByte(s[j-1]) || s[j-1] == '.') && isIdentByte(from[0])) ||
+			(end < len(s) && isIdentByte(s[end]) && isIdentByte(from[len(from)-1])) {
+			out.WriteString(s[i : j+1])
+			i = j + 1
+			continue
+		}
+		out.WriteString(s[i:j])
+		out.WriteString(to)
+		i = end
+		found++
+	}
+	out.WriteString(s[i:])
+	return out.String(), found > 0
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
 // shared utility for generators
 type printer struct {
-	w   io.Writer
-	err error
+	w     io.Writer
+	err   error
+	state *printState
+}
+
+// randIdent returns a new identifier for
+// a temporary variable of the printed code.
+func (p *printer) randIdent() string {
+	return p.state.ids.randIdent()
 }
 
 // writes "var {{name}} {{typ}};"
@@ -333,7 +534,7 @@ func (p *printer) declare(name string, typ string) {
 //     for key := range m { delete(m, key) }
 // }
 //
-func (p *printer) resizeMap(size string, isnil string, m *Map, ctx string) []string {
+func (p *printer) resizeMap(size string, isnil string, m *Map, ctx string) []Diagnostic {
 	vn := m.Varname()
 	if !p.ok() {
 		return nil
@@ -341,7 +542,7 @@ func (p *printer) resizeMap(size string, isnil string, m *Map, ctx string) []str
 
 	allocbound := m.AllocBound()
 	if allocbound == "" {
-		return []string{fmt.Sprintf("Missing allocbound on map %v", m)}
+		return []Diagnostic{diagf(m, "Missing allocbound on map %s", m.Varname())}
 	}
 	allocbound = strings.Split(allocbound, ",")[0]
 	if allocbound != "-" {
@@ -385,10 +586,10 @@ func (p *printer) wrapErrCheck(ctx string) {
 	p.print("\n}")
 }
 
-func (p *printer) resizeSlice(size string, isnil string, s *Slice, ctx string) []string {
+func (p *printer) resizeSlice(size string, isnil string, s *Slice, ctx string) []Diagnostic {
 	allocbound := s.AllocBound()
 	if allocbound == "" {
-		return []string{fmt.Sprintf("Missing allocbound on slice %v", s)}
+		return []Diagnostic{diagf(s, "Missing allocbound on slice %s", s.Varname())}
 	}
 	allocbound = strings.Split(allocbound, ",")[0]
 	if allocbound != "-" {
@@ -426,10 +627,10 @@ func (p *printer) closeblock() { p.print("\n}") }
 //     {{generate inner}}
 // }
 //
-func (p *printer) rangeBlock(ctx *Context, idx string, iter string, t traversal, inner Elem) {
+func (p *printer) rangeBlock(ctx *Context, idx string, iter string, t Traversal, inner Elem) {
 	ctx.PushVar(idx)
 	p.printf("\n for %s := range %s {", idx, iter)
-	next(t, inner)
+	Next(t, inner)
 	p.closeblock()
 	ctx.Pop()
 }
@@ -6,7 +6,11 @@ import (
 )
 
 var (
-	marshalTestTempl = template.New("MarshalTest")
+	marshalTestTempl  = template.New("MarshalTest")
+	testTemplateFuncs = template.FuncMap{
+		"maxSize":        getMaxSizeMethod,
+		"maxSizeChecked": (*Registry)(nil).maxSizeExpr,
+	}
 )
 
 // TODO(philhofer):
@@ -16,21 +20,43 @@ var (
 // "Type{}" syntax.
 // we should support all the types.
 
-func mtest(w io.Writer) *mtestGen {
-	return &mtestGen{w: w}
+func mtest(w io.Writer, st *printState) *mtestGen {
+	return &mtestGen{w: w, templ: marshalTestTempl, state: st}
 }
 
 type mtestGen struct {
-	passes
-	w io.Writer
+	Passes
+	w     io.Writer
+	templ *template.Template
+	state *printState
+	bound *template.Template // templ calling maxSizeChecked with state.reg
+}
+
+// ParseTestTemplate parses a template for the generated
+// tests, which is executed once for every type with that
+// type's Elem. Besides the text/template builtins, it can
+// call maxSize with a type name to get the expression for
+// that type's MaxSize, and maxSizeChecked to get a pair of
+// expressions for the size and whether it is bounded, which
+// also works for types marked by //msgp:unbounded.
+func ParseTestTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(testTemplateFuncs).Parse(text)
 }
 
-func (m *mtestGen) Execute(p Elem) ([]string, error) {
-	p = m.applyall(p)
-	if p != nil && !IsDangling(p) {
+func (m *mtestGen) Execute(p Elem) ([]Diagnostic, error) {
+	p = m.ApplyAll(p)
+	// generic types can't be instantiated without type arguments
+	if p != nil && !IsDangling(p) && p.TypeParams() == nil {
 		switch p.(type) {
 		case *Struct, *Array, *Slice, *Map:
-			return nil, marshalTestTempl.Execute(m.w, p)
+			if m.bound == nil {
+				t, err := m.templ.Clone()
+				if err != nil {
+					return nil, err
+				}
+				m.bound = t.Funcs(template.FuncMap{"maxSizeChecked": m.state.reg.maxSizeExpr})
+			}
+			return nil, m.bound.Execute(m.w, p)
 		}
 	}
 	return nil, nil
@@ -39,8 +65,8 @@ func (m *mtestGen) Execute(p Elem) ([]string, error) {
 func (m *mtestGen) Method() Method { return marshaltest }
 
 func init() {
+	marshalTestTempl.Funcs(testTemplateFuncs)
 	template.Must(marshalTestTempl.Parse(`func TestMarshalUnmarshal{{.TypeName}}(t *testing.T) {
-	partitiontest.PartitionTest(t)
 	v := {{.TypeName}}{}
 	bts := v.MarshalMsg(nil)
 	left, err := v.UnmarshalMsg(bts)
@@ -61,7 +87,34 @@ func init() {
 }
 
 func TestRandomizedEncoding{{.TypeName}}(t *testing.T) {
-	protocol.RunEncodingTest(t, &{{.TypeName}}{})
+	maxSize, bounded := {{maxSizeChecked .TypeName}}
+
+	seed := msgp.RandomSeed()
+	t.Logf("seed %d; rerun with MSGP_SEED=%d to reproduce", seed, seed)
+	r := rand.New(rand.NewSource(seed))
+	for i := 0; i < 100; i++ {
+		var v {{.TypeName}}
+		v.RandomizeMsg(r, 4)
+		bts := v.MarshalMsg(nil)
+		if v.Msgsize() < len(bts) {
+			t.Fatalf("seed %d: Msgsize() is %d, but the encoding of %#v is %d bytes", seed, v.Msgsize(), v, len(bts))
+		}
+		if bounded && len(bts) > maxSize {
+			t.Fatalf("seed %d: MaxSize is %d, but the encoding of %#v is %d bytes", seed, maxSize, v, len(bts))
+		}
+
+		var d {{.TypeName}}
+		left, err := d.UnmarshalMsg(bts)
+		if err != nil {
+			t.Fatalf("seed %d: unmarshaling %#v: %v", seed, v, err)
+		}
+		if len(left) > 0 {
+			t.Fatalf("seed %d: %d bytes left over after UnmarshalMsg(): %q", seed, len(left), left)
+		}
+		if again := d.MarshalMsg(nil); !bytes.Equal(bts, again) {
+			t.Fatalf("seed %d: %#v was encoded as %x, but re-encoded as %x", seed, v, bts, again)
+		}
+	}
 }
 
 func BenchmarkMarshalMsg{{.TypeName}}(b *testing.B) {
@@ -36,6 +36,16 @@ func (t *Topics) Bytes() []byte {
 	return outbuf.Bytes()
 }
 
+// Structs returns the methods implemented
+// for each type, keyed by the type name.
+func (t *Topics) Structs() map[string][]string {
+	m := make(map[string][]string, len(t.structs))
+	for key, values := range t.structs {
+		m[key] = append([]string(nil), values...)
+	}
+	return m
+}
+
 func (t *Topics) Add(key, value string) {
 	if t.structs == nil {
 		t.structs = make(map[string][]string)
@@ -7,19 +7,19 @@ import (
 	"strings"
 )
 
-func unmarshal(w io.Writer, topics *Topics) *unmarshalGen {
+func unmarshal(w io.Writer, topics *Topics, st *printState) *unmarshalGen {
 	return &unmarshalGen{
-		p:      printer{w: w},
+		p:      printer{w: w, state: st},
 		topics: topics,
 	}
 }
 
 type unmarshalGen struct {
-	passes
+	Passes
 	p        printer
 	hasfield bool
 	ctx      *Context
-	msgs     []string
+	msgs     []Diagnostic
 	topics   *Topics
 }
 
@@ -33,37 +33,38 @@ func (u *unmarshalGen) needsField() {
 	u.hasfield = true
 }
 
-func (u *unmarshalGen) Execute(p Elem) ([]string, error) {
+func (u *unmarshalGen) Execute(p Elem) ([]Diagnostic, error) {
 	u.msgs = nil
 	u.hasfield = false
 	if !u.p.ok() {
 		return u.msgs, u.p.err
 	}
-	p = u.applyall(p)
+	p = u.ApplyAll(p)
 	if p == nil {
 		return u.msgs, nil
 	}
 
-	// We might change p.Varname in methodReceiver(); make a copy
+	// We might change p.Varname in MethodReceiver(); make a copy
 	// to not affect other code that will use p.
 	p = p.Copy()
 
 	u.ctx = &Context{}
 
-	u.p.comment("UnmarshalMsg implements msgp.Unmarshaler")
-
 	if IsDangling(p) {
 		baseType := p.(*BaseElem).IdentName
 		c := p.Varname()
-		methodRecv := methodReceiver(p)
+		methodRecv := MethodReceiver(p)
+		u.p.comment("UnmarshalMsg implements msgp.Unmarshaler")
 		u.p.printf("\nfunc (%s %s) UnmarshalMsg(bts []byte) ([]byte, error) {", c, methodRecv)
 		u.p.printf("\n  return ((*(%s))(%s)).UnmarshalMsg(bts)", baseType, c)
 		u.p.printf("\n}")
 
+		u.p.comment("UnmarshalMsgWithState implements msgp.Unmarshaler")
 		u.p.printf("\nfunc (%s %s) UnmarshalMsgWithState(bts []byte, st msgp.UnmarshalState) ([]byte, error) {", c, methodRecv)
 		u.p.printf("\n  return ((*(%s))(%s)).UnmarshalMsgWithState(bts, st)", baseType, c)
 		u.p.printf("\n}")
 
+		u.p.comment("CanUnmarshalMsg implements msgp.Unmarshaler")
 		u.p.printf("\nfunc (_ %[2]s) CanUnmarshalMsg(%[1]s interface{}) bool {", c, methodRecv)
 		u.p.printf("\n  _, ok := (%s).(%s)", c, methodRecv)
 		u.p.printf("\n  return ok")
@@ -78,15 +79,16 @@ func (u *unmarshalGen) Execute(p Elem) ([]string, error) {
 
 	// save the vname before calling methodReceiver
 	c := p.Varname()
-	methodRecv := methodReceiver(p)
+	methodRecv := MethodReceiver(p)
 
+	u.p.comment("UnmarshalMsgWithState implements msgp.Unmarshaler")
 	u.p.printf("\nfunc (%s %s) UnmarshalMsgWithState(bts []byte, st msgp.UnmarshalState) (o []byte, err error) {", c, methodRecv)
 	u.p.printf("\n  if st.AllowableDepth == 0 {")
 	u.p.printf("\n    err = msgp.ErrMaxDepthExceeded{}")
 	u.p.printf("\n    return")
 	u.p.printf("\n  }")
 	u.p.printf("\n  st.AllowableDepth--")
-	next(u, p)
+	Next(u, p)
 	u.p.print("\no = bts")
 
 	// right before the return: attempt to inspect well formed:
@@ -101,10 +103,12 @@ func (u *unmarshalGen) Execute(p Elem) ([]string, error) {
 	}
 	u.p.nakedReturn()
 
+	u.p.comment("UnmarshalMsg implements msgp.Unmarshaler")
 	u.p.printf("\nfunc (%s %s) UnmarshalMsg(bts []byte) (o []byte, err error) {", c, methodRecv)
 	u.p.printf("\n return %s.UnmarshalMsgWithState(bts, msgp.DefaultUnmarshalState)", c)
 	u.p.printf("\n}")
 
+	u.p.comment("CanUnmarshalMsg implements msgp.Unmarshaler")
 	u.p.printf("\nfunc (_ %[2]s) CanUnmarshalMsg(%[1]s interface{}) bool {", c, methodRecv)
 	u.p.printf("\n  _, ok := (%s).(%s)", c, methodRecv)
 	u.p.printf("\n  return ok")
@@ -126,7 +130,7 @@ func (u *unmarshalGen) assignAndCheck(name string, isnil string, base string) {
 	u.p.wrapErrCheck(u.ctx.ArgsStr())
 }
 
-func (u *unmarshalGen) gStruct(s *Struct) {
+func (u *unmarshalGen) GStruct(s *Struct) {
 	if !u.p.ok() {
 		return
 	}
@@ -141,7 +145,7 @@ func (u *unmarshalGen) gStruct(s *Struct) {
 func (u *unmarshalGen) tuple(s *Struct) {
 
 	// open block
-	sz := randIdent()
+	sz := u.p.randIdent()
 	u.p.declare(sz, "int")
 	u.assignAndCheck(sz, "_", arrayHeader)
 	u.p.arrayCheck(strconv.Itoa(len(s.Fields)), sz)
@@ -150,15 +154,15 @@ func (u *unmarshalGen) tuple(s *Struct) {
 			return
 		}
 		u.ctx.PushString(s.Fields[i].FieldName)
-		next(u, s.Fields[i].FieldElem)
+		Next(u, s.Fields[i].FieldElem)
 		u.ctx.Pop()
 	}
 }
 
 func (u *unmarshalGen) mapstruct(s *Struct) {
 	u.needsField()
-	sz := randIdent()
-	isnil := randIdent()
+	sz := u.p.randIdent()
+	isnil := u.p.randIdent()
 	u.p.declare(sz, "int")
 	u.p.declare(isnil, "bool")
 
@@ -179,7 +183,8 @@ func (u *unmarshalGen) mapstruct(s *Struct) {
 		u.p.printf("\nif %s > 0 {", sz)
 		u.p.printf("\n%s--", sz)
 		u.ctx.PushString(s.Fields[i].FieldName)
-		next(u, s.Fields[i].FieldElem)
+		Next(u, s.Fields[i].FieldElem)
+		u.arrayVersionCheck(&s.Fields[i])
 		u.ctx.Pop()
 		u.p.printf("\n}")
 	}
@@ -197,6 +202,14 @@ func (u *unmarshalGen) mapstruct(s *Struct) {
 	u.p.printf("\n  %s = %s{}", s.Varname(), s.TypeName())
 	u.p.printf("\n}")
 
+	// a field with old wire keys may only be decoded once
+	seen := make(map[int]string)
+	for i := range s.Fields {
+		if len(s.Fields[i].Aliases) > 0 && ast.IsExported(s.Fields[i].FieldName) {
+			seen[i] = u.p.randIdent()
+			u.p.declare(seen[i], "bool")
+		}
+	}
 	u.p.printf("\nfor %s > 0 {", sz)
 	u.p.printf("\n%s--; field, bts, err = msgp.ReadMapKeyZC(bts)", sz)
 	u.p.wrapErrCheck(u.ctx.ArgsStr())
@@ -209,9 +222,18 @@ func (u *unmarshalGen) mapstruct(s *Struct) {
 		if !u.p.ok() {
 			return
 		}
+		u.aliasCases(s, &s.Fields[i])
 		u.p.printf("\ncase \"%s\":", s.Fields[i].FieldTag)
 		u.ctx.PushString(s.Fields[i].FieldName)
-		next(u, s.Fields[i].FieldElem)
+		if v, ok := seen[i]; ok {
+			u.p.printf("\nif %s {", v)
+			u.p.printf("\nerr = msgp.ErrDuplicateField(string(field))")
+			u.p.wrapErrCheck(u.ctx.ArgsStr())
+			u.p.printf("\n}")
+			u.p.printf("\n%s = true", v)
+		}
+		u.versionCheck(&s.Fields[i])
+		Next(u, s.Fields[i].FieldElem)
 		u.ctx.Pop()
 	}
 	u.p.print("\ndefault:\nerr = msgp.ErrNoField(string(field))")
@@ -221,7 +243,63 @@ func (u *unmarshalGen) mapstruct(s *Struct) {
 	u.p.print("\n}") // close else statement for array decode
 }
 
-func (u *unmarshalGen) gBase(b *BaseElem) {
+// aliasCases writes a case for each old wire key of the
+// field. The cases fall through to the canonical key, so
+// they must be printed immediately before it. Strict
+// decoding rejects the old keys.
+func (u *unmarshalGen) aliasCases(s *Struct, sf *StructField) {
+	for _, alias := range sf.Aliases {
+		for i := range s.Fields {
+			if !ast.IsExported(s.Fields[i].FieldName) {
+				continue
+			}
+			if s.Fields[i].FieldTag == alias || (&s.Fields[i] != sf && s.Fields[i].HasAlias(alias)) {
+				u.msgs = append(u.msgs, diagf(sf.FieldElem, "Alias %q of field %s collides with field %s", alias, sf.FieldName, s.Fields[i].FieldName))
+				return
+			}
+		}
+
+		u.p.printf("\ncase \"%s\":", alias)
+		u.p.printf("\nif st.Strict {")
+		u.p.printf("\nerr = msgp.ErrNoField(string(field))")
+		u.p.wrapErrCheck(u.ctx.ArgsStr())
+		u.p.printf("\n}")
+		u.p.printf("\nfallthrough")
+	}
+}
+
+// versionCheck rejects a field that is not valid
+// for the protocol version being decoded.
+func (u *unmarshalGen) versionCheck(sf *StructField) {
+	if !sf.Versioned() {
+		return
+	}
+	u.p.printf("\nif !%s {", sf.VersionCheckExpr("st.Version"))
+	u.p.printf("\nerr = msgp.FieldVersionError{Field: %q, Version: st.Version}", sf.FieldTag)
+	u.p.wrapErrCheck(u.ctx.ArgsStr())
+	u.p.printf("\n}")
+}
+
+// arrayVersionCheck rejects a field decoded from an array
+// that is not valid for the protocol version being decoded.
+// An array has an element for every field, so a zero value
+// stands for a field that is absent from this version.
+func (u *unmarshalGen) arrayVersionCheck(sf *StructField) {
+	if !sf.Versioned() {
+		return
+	}
+	ize := sf.FieldElem.IfZeroExpr()
+	if ize == "" {
+		u.versionCheck(sf)
+		return
+	}
+	u.p.printf("\nif !%s && !(%s) {", sf.VersionCheckExpr("st.Version"), ize)
+	u.p.printf("\nerr = msgp.FieldVersionError{Field: %q, Version: st.Version}", sf.FieldTag)
+	u.p.wrapErrCheck(u.ctx.ArgsStr())
+	u.p.printf("\n}")
+}
+
+func (u *unmarshalGen) GBase(b *BaseElem) {
 	if !u.p.ok() {
 		return
 	}
@@ -230,7 +308,7 @@ func (u *unmarshalGen) gBase(b *BaseElem) {
 	lowered := b.Varname() // passed as argument
 	if b.Convert {
 		// begin 'tmp' block
-		refname = randIdent()
+		refname = u.p.randIdent()
 		lowered = b.ToBase() + "(" + lowered + ")"
 		u.p.printf("\n{\nvar %s %s", refname, b.BaseType())
 	}
@@ -238,7 +316,7 @@ func (u *unmarshalGen) gBase(b *BaseElem) {
 	switch b.Value {
 	case Bytes:
 		if b.common.AllocBound() != "" {
-			sz := randIdent()
+			sz := u.p.randIdent()
 			u.p.printf("\nvar %s int", sz)
 			u.p.printf("\n%s, err = msgp.ReadBytesBytesHeader(bts)", sz)
 			u.p.wrapErrCheck(u.ctx.ArgsStr())
@@ -254,7 +332,7 @@ func (u *unmarshalGen) gBase(b *BaseElem) {
 		u.p.printf("\nbts, err = %s.UnmarshalMsgWithState(bts, st)", lowered)
 	case String:
 		if b.common.AllocBound() != "" {
-			sz := randIdent()
+			sz := u.p.randIdent()
 			u.p.printf("\nvar %s int", sz)
 			u.p.printf("\n%s, err = msgp.ReadBytesBytesHeader(bts)", sz)
 			u.p.wrapErrCheck(u.ctx.ArgsStr())
@@ -281,7 +359,7 @@ func (u *unmarshalGen) gBase(b *BaseElem) {
 	}
 }
 
-func (u *unmarshalGen) gArray(a *Array) {
+func (u *unmarshalGen) GArray(a *Array) {
 	if !u.p.ok() {
 		return
 	}
@@ -294,24 +372,24 @@ func (u *unmarshalGen) gArray(a *Array) {
 		return
 	}
 
-	sz := randIdent()
+	sz := u.p.randIdent()
 	u.p.declare(sz, "int")
 	u.assignAndCheck(sz, "_", arrayHeader)
 	u.p.arrayCheckBound(a.Size, sz)
 
 	u.ctx.PushVar(a.Index)
 	u.p.printf("\nfor %[1]s := 0; %[1]s < %[2]s; %[1]s++ {", a.Index, sz)
-	next(u, a.Els)
+	Next(u, a.Els)
 	u.p.closeblock()
 	u.ctx.Pop()
 }
 
-func (u *unmarshalGen) gSlice(s *Slice) {
+func (u *unmarshalGen) GSlice(s *Slice) {
 	if !u.p.ok() {
 		return
 	}
-	sz := randIdent()
-	isnil := randIdent()
+	sz := u.p.randIdent()
+	isnil := u.p.randIdent()
 	u.p.declare(sz, "int")
 	u.p.declare(isnil, "bool")
 	u.assignAndCheck(sz, isnil, arrayHeader)
@@ -325,12 +403,12 @@ func (u *unmarshalGen) gSlice(s *Slice) {
 	u.p.rangeBlock(u.ctx, s.Index, s.Varname(), u, childElement)
 }
 
-func (u *unmarshalGen) gMap(m *Map) {
+func (u *unmarshalGen) GMap(m *Map) {
 	if !u.p.ok() {
 		return
 	}
-	sz := randIdent()
-	isnil := randIdent()
+	sz := u.p.randIdent()
+	isnil := u.p.randIdent()
 	u.p.declare(sz, "int")
 	u.p.declare(isnil, "bool")
 	u.assignAndCheck(sz, isnil, mapHeader)
@@ -342,17 +420,17 @@ func (u *unmarshalGen) gMap(m *Map) {
 	// loop and get key,value
 	u.p.printf("\nfor %s > 0 {", sz)
 	u.p.printf("\nvar %s %s; var %s %s; %s--", m.Keyidx, m.Key.TypeName(), m.Validx, m.Value.TypeName(), sz)
-	next(u, m.Key)
+	Next(u, m.Key)
 	u.ctx.PushVar(m.Keyidx)
-	next(u, m.Value)
+	Next(u, m.Value)
 	u.ctx.Pop()
 	u.p.mapAssign(m)
 	u.p.closeblock()
 }
 
-func (u *unmarshalGen) gPtr(p *Ptr) {
+func (u *unmarshalGen) GPtr(p *Ptr) {
 	u.p.printf("\nif msgp.IsNil(bts) { bts, err = msgp.ReadNilBytes(bts); if err != nil { return }; %s = nil; } else { ", p.Varname())
 	u.p.initPtr(p)
-	next(u, p.Value)
+	Next(u, p.Value)
 	u.p.closeblock()
 }
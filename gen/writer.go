@@ -0,0 +1,44 @@
+package gen
+
+// A Writer writes the code of a Plugin's Generator. After the
+// first error, writes are skipped, and Err returns the error.
+type Writer struct {
+	p printer
+}
+
+// Printf writes the formatted code.
+func (w *Writer) Printf(format string, args ...interface{}) { w.p.printf(format, args...) }
+
+// Print writes code verbatim.
+func (w *Writer) Print(s string) { w.p.print(s) }
+
+// Comment writes a line comment.
+func (w *Writer) Comment(s string) { w.p.comment(s) }
+
+// Declare writes "var name typ".
+func (w *Writer) Declare(name string, typ string) { w.p.declare(name, typ) }
+
+// CloseBlock writes the closing brace of a block.
+func (w *Writer) CloseBlock() { w.p.closeblock() }
+
+// NakedReturn writes "return" and closes the function,
+// unless a write failed.
+func (w *Writer) NakedReturn() { w.p.nakedReturn() }
+
+// WrapErrCheck writes a check of err that wraps it with
+// the path ctx, as returned by Context.ArgsStr, and returns.
+func (w *Writer) WrapErrCheck(ctx string) { w.p.wrapErrCheck(ctx) }
+
+// RangeBlock writes a loop ranging over iter with the index idx,
+// whose body t generates for inner, and pushes idx onto ctx while
+// generating it.
+func (w *Writer) RangeBlock(ctx *Context, idx string, iter string, t Traversal, inner Elem) {
+	w.p.rangeBlock(ctx, idx, iter, t, inner)
+}
+
+// Ident returns a new identifier for a temporary variable,
+// unique within the code written for the Elem being executed.
+func (w *Writer) Ident() string { return w.p.randIdent() }
+
+// Err returns the error of the first failed write.
+func (w *Writer) Err() error { return w.p.err }
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/algorand/msgp/gen"
+	"github.com/algorand/msgp/msgpgen"
+	"github.com/algorand/msgp/printer"
+)
+
+// runGenerated generates the methods of mode for the package in
+// testdata/run/<name>, in a copy of it inside the module, and runs
+// the tests of the package, which check the generated code.
+func runGenerated(t *testing.T, name string, mode gen.Method) {
+	dir, _ := generateRun(t, name, mode, nil)
+	if out, err := testRun(dir); err != nil {
+		t.Fatalf("testing the generated code of %s: %v\n%s", name, err, out)
+	}
+}
+
+// generateRun writes the methods of mode for the package in
+// testdata/run/<name>, once per tag set if there are any, to a
+// copy of it inside the module, and returns the directory of
+// the copy, and the outputs written.
+func generateRun(t *testing.T, name string, mode gen.Method, tagSets [][]string) (string, msgpgen.Result) {
+	if testing.Short() {
+		t.Skip("compiles generated code")
+	}
+	src := filepath.Join("testdata", "run", name)
+	dir, err := os.MkdirTemp("testdata", "run-"+name+"-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	files, err := filepath.Glob(filepath.Join(src, "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, filepath.Base(file)), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := msgpgen.Generate(context.Background(), msgpgen.Options{
+		Input:      "./" + filepath.ToSlash(dir),
+		Mode:       mode,
+		Unexported: true,
+		TagSets:    tagSets,
+		Format:     printer.DefaultFormatOptions,
+		Test:       printer.DefaultTestOptions,
+	})
+	if err != nil {
+		t.Fatalf("generating %s: %v", name, err)
+	}
+	for _, o := range res.Outputs {
+		for _, r := range o.Files {
+			if err := os.WriteFile(r.File, r.Data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return dir, res
+}
+
+// testRun runs the tests of the package in dir.
+func testRun(dir string) ([]byte, error) {
+	return exec.Command("go", "test", "-count=1", "./"+filepath.ToSlash(dir)).CombinedOutput()
+}
+
+func TestGeneratedVersions(t *testing.T) {
+	runGenerated(t, "versions", gen.Marshal|gen.Unmarshal|gen.Size|gen.IsZero)
+}
+
+func TestGeneratedAliases(t *testing.T) {
+	runGenerated(t, "aliases", gen.Marshal|gen.Unmarshal|gen.Size)
+}
+
+func TestGeneratedCopies(t *testing.T) {
+	runGenerated(t, "copies", gen.Marshal|gen.Unmarshal|gen.Size|gen.IsZero|gen.Copy)
+}
+
+func TestGeneratedEquals(t *testing.T) {
+	runGenerated(t, "equals", gen.Marshal|gen.Unmarshal|gen.Size|gen.IsZero|gen.Equal)
+}
+
+func TestGeneratedShimKeys(t *testing.T) {
+	runGenerated(t, "shimkeys", gen.Marshal|gen.Unmarshal|gen.Size|gen.IsZero)
+}
+
+func TestGeneratedMapAllocs(t *testing.T) {
+	runGenerated(t, "mapallocs", gen.Marshal|gen.Unmarshal|gen.Size|gen.IsZero)
+}
+
+func TestGeneratedGolden(t *testing.T) {
+	dir, res := generateRun(t, "golden", gen.Marshal|gen.Unmarshal|gen.Size|gen.IsZero|gen.Golden, nil)
+	if out, err := testRun(dir); err == nil || !strings.Contains(string(out), "does not exist") {
+		t.Fatalf("the golden test passed without a golden file: %v\n%s", err, out)
+	}
+
+	for _, o := range res.Outputs {
+		if err := writeGoldens(o, printer.DefaultTestOptions.Tags, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	golden := filepath.Join(dir, "testdata", "msgp", "G.golden")
+	data, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := testRun(dir); err != nil {
+		t.Fatalf("testing against %s: %v\n%s", golden, err, out)
+	}
+
+	// an existing golden file is checked, not rewritten
+	if err := os.WriteFile(golden, append(data, "c0\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range res.Outputs {
+		if err := writeGoldens(o, printer.DefaultTestOptions.Tags, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if out, err := testRun(dir); err == nil {
+		t.Fatalf("the golden test accepted a value that is not a G:\n%s", out)
+	}
+}
+
+func TestGeneratedTagSets(t *testing.T) {
+	dir, res := generateRun(t, "tagsets", gen.Marshal|gen.Unmarshal|gen.Size|gen.IsZero|gen.MaxSize|gen.Test,
+		[][]string{{"linux", "!rocksdb"}, {"rocksdb"}})
+	if len(res.Outputs) != 2 || !strings.HasSuffix(res.Outputs[0].File, "tagsets_linux_notrocksdb_gen.go") {
+		t.Fatalf("outputs %+v, expected one per tag set", res.Outputs)
+	}
+
+	// the files of each tag set build, and pass vet,
+	// with exactly one set of methods
+	check := func(cmds ...string) {
+		for _, tags := range []string{"", "rocksdb"} {
+			for _, cmd := range cmds {
+				c := exec.Command("go", cmd, "-tags="+tags, "./"+filepath.ToSlash(dir))
+				c.Env = append(os.Environ(), "GOOS=linux")
+				if out, err := c.CombinedOutput(); err != nil {
+					t.Errorf("go %s -tags=%s: %v\n%s", cmd, tags, err, out)
+				}
+			}
+		}
+	}
+	check("vet", "test")
+
+	// formatting rewrites the +build lines after the
+	// //go:build ones, so vet the build headers as written
+	for _, o := range res.Outputs {
+		for _, r := range o.Files {
+			if err := os.Remove(r.File); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	fopts := printer.DefaultFormatOptions
+	fopts.Skip = true
+	res, err := msgpgen.Generate(context.Background(), msgpgen.Options{
+		Input:      "./" + filepath.ToSlash(dir),
+		Mode:       gen.Marshal | gen.Unmarshal | gen.Size | gen.IsZero | gen.MaxSize,
+		Unexported: true,
+		TagSets:    [][]string{{"linux", "!rocksdb"}, {"rocksdb"}},
+		Format:     fopts,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range res.Outputs {
+		for _, r := range o.Files {
+			if err := os.WriteFile(r.File, r.Data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	check("vet")
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/algorand/msgp/gen"
+	"github.com/algorand/msgp/parse"
+)
+
+func TestInterfaceFields(t *testing.T) {
+	fs, err := parse.File("testdata/intf.go", true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var topics gen.Topics
+	if err := fs.PrintTo(gen.NewPrinter(gen.Marshal|gen.Unmarshal|gen.Size|gen.Equal, &topics, io.Discard, nil)); err == nil {
+		t.Fatal("expected an error for the interface fields")
+	}
+	wants := []string{"testdata/intf.go:12:2: error: Intf: MsgEqual does not support interface field of type interface{}"}
+	for _, pos := range []string{"testdata/intf.go:12:2", "testdata/intf.go:13:2", "testdata/intf.go:14:15"} {
+		wants = append(wants, pos+": error: Intf: Field of interface type interface{} has no MessagePack encoding")
+	}
+	for _, want := range wants {
+		found := false
+		for _, d := range fs.Diagnostics {
+			found = found || strings.HasPrefix(d.String(), want)
+		}
+		if !found {
+			t.Errorf("no diagnostic %q in %v", want, fs.Diagnostics)
+		}
+	}
+}
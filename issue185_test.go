@@ -152,7 +152,7 @@ func loadVars(tpl *template.Template, tplData interface{}) (vars extractedVars,
 		fmt.Println(tempDir)
 	}
 	tfile := filepath.Join(tempDir, "msg.go")
-	genFile := newFilename(tfile, "")
+	genFile := filepath.Join(tempDir, "msg_gen.go")
 
 	if err = goGenerateTpl(tempDir, tfile, tpl, tplData); err != nil {
 		err = fmt.Errorf("could not generate code: %v", err)
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/algorand/msgp/parse"
+)
+
+func TestLint(t *testing.T) {
+	fs, err := parse.File("testdata/lint.go", true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := fs.Lint(); n != 7 {
+		t.Errorf("%d findings, expected 7: %v", n, fs.Diagnostics)
+	}
+	for _, want := range []string{
+		"testdata/lint.go:9:2: warning: Linted.F is a float",
+		"testdata/lint.go:10:2: warning: Linted.When is a time.Time",
+		"testdata/lint.go:11:2: warning: Linted.Any is an interface{}",
+		"testdata/lint.go:12:2: warning: slice Linted.Names has no allocbound",
+		"testdata/lint.go:12:12: warning: string Linted.Names[] has no allocbound",
+		"testdata/lint.go:13:2: warning: map keys of Linted.Keys cannot be sorted",
+		"testdata/lint.go:14:2: warning: exported field Linted.Untag has no codec tag",
+	} {
+		found := false
+		for _, d := range fs.Diagnostics {
+			found = found || strings.HasPrefix(d.String(), want)
+		}
+		if !found {
+			t.Errorf("no finding %q in %v", want, fs.Diagnostics)
+		}
+	}
+	for _, d := range fs.Diagnostics {
+		if strings.Contains(d.Message, "Bounded") || strings.Contains(d.Message, "Untagged") {
+			t.Errorf("unexpected finding %v", d)
+		}
+	}
+}
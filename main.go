@@ -13,23 +13,63 @@
 // following options are supported, if you need them:
 //
 //  -o = output file name (default is {input}_gen.go)
-//  -file = input file name (or directory; default is $GOFILE, which is set by the `go generate` command)
+//  -file = input file name (or directory, or package pattern such as ./...; default is $GOFILE, which is set by the `go generate` command)
 //  -io = satisfy the `msgp.Decodable` and `msgp.Encodable` interfaces (default is true)
 //  -marshal = satisfy the `msgp.Marshaler` and `msgp.Unmarshaler` interfaces (default is true)
 //  -tests = generate tests and benchmarks (default is true)
+//  -copy = create MsgCopy deep-copy methods (default is false)
+//  -equal = create MsgEqual wire-equality methods (default is false)
+//  -randomize = create RandomizeMsg methods in the generated file, for use by the tests of other packages; otherwise,
+//               the generated tests declare them (default is false)
+//  -fuzz = generate FuzzUnmarshal fuzz targets (default is false)
+//  -golden = generate tests checking the canonical encodings against testdata/msgp/{Type}.golden, and write the
+//            golden files missing by running these tests with MSGP_UPDATE_GOLDEN=1 (default is false)
+//  -tags = comma-separated build tags satisfied while loading the input, as with go build -tags
+//  -env = comma-separated KEY=VALUE pairs, such as GOOS=windows, added to the environment of the go command
+//  -tagsets = space-separated tag sets, such as "rocksdb !rocksdb", each a comma-separated list of tags; generates
+//             once per set, loading the input with its tags, to {input}_{set}_gen.go requiring them, e.g.
+//             x_rocksdb_gen.go with //go:build rocksdb. The sets should be exclusive, so that no build
+//             includes the methods generated for two of them
+//  -per-file = generate the types declared in each input file, resolved with the rest of its package,
+//              to its own {file}_gen.go; -file may then list several files, separated by commas (default is false)
+//  -test-template = text/template file replacing the generated tests, executed with each type's gen.Elem
+//  -test-imports = comma-separated imports added to the test file, optionally aliased as `name "path"`
+//  -test-tags = comma-separated build tags required by the test file (default is !skip_msgp_testing)
+//  -import-sections = comma-separated gci sections grouping the imports, or empty to keep the goimports grouping
+//                     (default is standard,default,prefix(github.com/algorand),prefix(github.com/algorand/go-algorand))
+//  -json = print diagnostics to stderr as JSON objects, one per line, instead of file:line:col: severity: message
+//  -Werror = fail, before writing any file, if the input has any warning
+//  -schema = write the wire schema of the input types to a JSON file
+//  -verify = generate in memory, and fail with a unified diff if the existing _gen.go and _gen_test.go files differ,
+//            or would no longer be generated
+//  -lint = report constructs that threaten a canonical, bounded encoding, instead of generating code
+//
+// To check that a revision of the types is wire-compatible with another,
+// compare the schemas written by -schema for both revisions:
+//
+//     msgp compat old.json new.json
+//
+// which prints every change, and fails if any change is breaking.
 //
 // For more information, please read README.md, and the wiki at github.com/tinylib/msgp
 //
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/algorand/msgp/gen"
+	"github.com/algorand/msgp/msgpgen"
 	"github.com/algorand/msgp/parse"
 	"github.com/algorand/msgp/printer"
 	"github.com/ttacon/chalk"
@@ -37,17 +77,43 @@ import (
 
 var (
 	out         = flag.String("o", "", "output file")
-	file        = flag.String("file", "", "input file")
+	file        = flag.String("file", "", "input file, directory or package pattern")
 	marshal     = flag.Bool("marshal", true, "create Marshal and Unmarshal methods")
 	tests       = flag.Bool("tests", true, "create tests and benchmarks")
+	msgcopy     = flag.Bool("copy", false, "create MsgCopy methods")
+	msgequal    = flag.Bool("equal", false, "create MsgEqual methods")
+	randomize   = flag.Bool("randomize", false, "create RandomizeMsg methods, which are otherwise only declared by the generated tests")
+	fuzz        = flag.Bool("fuzz", false, "create fuzz targets for the decoders")
+	golden      = flag.Bool("golden", false, "create golden test vectors of the canonical encodings")
+	buildTags   = flag.String("tags", "", "comma-separated build tags for loading the input")
+	buildEnv    = flag.String("env", "", "comma-separated KEY=VALUE environment for loading the input, e.g. GOOS=windows")
+	tagSets     = flag.String("tagsets", "", "space-separated tag sets, each comma-separated, to generate once for each")
+	perFile     = flag.Bool("per-file", false, "only generate the types declared in each input file, to its own _gen.go")
+	testTempl   = flag.String("test-template", "", "text/template file for the generated tests")
+	testImports = flag.String("test-imports", "", "comma-separated imports for the generated tests")
+	testTags    = flag.String("test-tags", strings.Join(printer.DefaultTestOptions.Tags, ","), "comma-separated build tags for the generated tests")
+	importSecs  = flag.String("import-sections", strings.Join(printer.DefaultFormatOptions.ImportSections, ","), "comma-separated gci sections for imports; empty keeps the goimports grouping")
 	unexported  = flag.Bool("unexported", true, "also process unexported types")
 	skipFormat  = flag.Bool("skip-format", false, "skip formatting the generated code (for debug)")
 	warnPkgMask = flag.String("warnmask", "", "skip generating warnings on datatypes outside given package")
+	jsonDiags   = flag.Bool("json", false, "print diagnostics as JSON")
+	werror      = flag.Bool("Werror", false, "treat warnings as errors")
+	schema      = flag.String("schema", "", "write the wire schema of the types as JSON to this file")
+	verify      = flag.Bool("verify", false, "check that the generated files are up to date, printing a diff; write nothing")
+	lint        = flag.Bool("lint", false, "report constructs that threaten a canonical encoding; generate nothing")
 )
 
 func main() {
 	flag.Parse()
 
+	if flag.Arg(0) == "compat" {
+		if err := compat(flag.Args()[1:]); err != nil {
+			fmt.Println(chalk.Red.Color(err.Error()))
+			os.Exit(1)
+		}
+		return
+	}
+
 	// GOFILE is set by go generate
 	if *file == "" {
 		*file = os.Getenv("GOFILE")
@@ -57,15 +123,38 @@ func main() {
 		}
 	}
 
+	if *lint {
+		if err := Lint(*file, *unexported, *warnPkgMask); err != nil {
+			fmt.Println(chalk.Red.Color(err.Error()))
+			os.Exit(1)
+		}
+		return
+	}
+
 	var mode gen.Method
 	if *marshal {
 		mode |= (gen.Marshal | gen.Unmarshal | gen.Size | gen.IsZero | gen.MaxSize)
 	}
+	if *msgcopy {
+		mode |= gen.Copy
+	}
+	if *msgequal {
+		mode |= gen.Equal
+	}
+	if *randomize {
+		mode |= gen.Randomize
+	}
 	if *tests {
 		mode |= gen.Test
 	}
+	if *fuzz {
+		mode |= gen.Fuzz
+	}
+	if *golden {
+		mode |= gen.Golden
+	}
 
-	if mode&^gen.Test == 0 {
+	if mode&^(gen.Test|gen.Fuzz|gen.Golden) == 0 {
 		fmt.Println(chalk.Red.Color("No methods to generate; -marshal=false"))
 		os.Exit(1)
 	}
@@ -80,38 +169,242 @@ func main() {
 //
 //	err := msgp.Run("path/to/myfile.go", gen.Size|gen.Marshal|gen.Unmarshal|gen.Test, false)
 //
+// The path may also be a package pattern such as "./...", in which
+// case the methods of every matching package are written to its
+// own directory, and independent packages are generated in parallel.
+// See msgpgen.Generate to generate the methods without writing them.
 func Run(gofile string, mode gen.Method, unexported bool, warnPkgMask string) error {
-	if mode&^gen.Test == 0 {
+	if mode&^(gen.Test|gen.Fuzz|gen.Golden) == 0 {
 		return nil
 	}
 	fmt.Println(chalk.Magenta.Color("======== MessagePack Code Generator ======="))
 	fmt.Printf(chalk.Magenta.Color(">>> Input: \"%s\"\n"), gofile)
-	fs, err := parse.File(gofile, unexported, warnPkgMask)
+	opts := msgpgen.Options{
+		Input:       gofile,
+		Output:      *out,
+		Mode:        mode,
+		Unexported:  unexported,
+		WarnPkgMask: warnPkgMask,
+		PerFile:     *perFile,
+		Load:        loadOptions(),
+		Format: printer.FormatOptions{
+			Skip:           *skipFormat,
+			ImportSections: splitList(*importSecs),
+		},
+	}
+	for _, set := range strings.Fields(*tagSets) {
+		opts.TagSets = append(opts.TagSets, splitList(set))
+	}
+	var err error
+	if opts.Test, err = testOptions(); err != nil {
+		return err
+	}
+
+	res, err := msgpgen.Generate(context.Background(), opts)
 	if err != nil {
 		return err
 	}
+	if n := res.Count(parse.Warning); *werror && n > 0 {
+		return fmt.Errorf("%d warning(s) treated as errors (-Werror)", n)
+	}
+	if *schema != "" && len(res.Outputs) > 1 {
+		return fmt.Errorf("-schema describes a single output, but %s generates %d files", gofile, len(res.Outputs))
+	}
 
-	if len(fs.Identities) == 0 {
-		fmt.Println(chalk.Magenta.Color("No types requiring code generation were found!"))
+	var stale []error
+	for _, o := range res.Outputs {
+		if *verify {
+			diff, err := printer.DiffFiles(o.Files)
+			if err != nil {
+				return err
+			}
+			if diff != "" {
+				fmt.Print(diff)
+				stale = append(stale, fmt.Errorf("%s is out of date; re-run msgp", o.File))
+			}
+			// generated files that would no longer
+			// be written are out of date as well
+			obsolete := printer.Obsolete(o.File, o.Files)
+			if diff, err = printer.DiffFiles(obsolete); err != nil {
+				return err
+			}
+			fmt.Print(diff)
+			for _, r := range obsolete {
+				stale = append(stale, fmt.Errorf("%s is no longer generated; delete it", r.File))
+			}
+			continue
+		}
+		if len(o.Files) == 0 {
+			fmt.Println(chalk.Magenta.Color("No types requiring code generation were found!"))
+			continue
+		}
+		if *schema != "" {
+			if err := writeSchema(*schema, o.Schema); err != nil {
+				return err
+			}
+		}
+		for _, r := range o.Files {
+			if err := os.WriteFile(r.File, r.Data, 0600); err != nil {
+				return err
+			}
+			fmt.Printf(chalk.Magenta.Color(">>> Wrote and formatted \"%s\"\n"), r.File)
+		}
+		if mode&gen.Golden != 0 {
+			if err := writeGoldens(o, splitList(*testTags), splitList(*buildEnv)); err != nil {
+				return err
+			}
+		}
+	}
+	return errors.Join(stale...)
+}
+
+var goldenTest = regexp.MustCompile(`(?m)^func TestGolden(\w+)\(`)
+
+// writeGoldens writes the golden files of the golden tests
+// generated to o that are missing, by running these tests
+// with MSGP_UPDATE_GOLDEN set, so that they check the files
+// from then on. The tests build with the tags of o and the
+// tags required by the test file, in the environment env.
+func writeGoldens(o msgpgen.Output, testTags []string, env []string) error {
+	var dir string
+	var missing []string
+	for _, r := range o.Files {
+		for _, m := range goldenTest.FindAllSubmatch(r.Data, -1) {
+			dir = filepath.Dir(r.File)
+			golden := filepath.Join(dir, "testdata", "msgp", string(m[1])+".golden")
+			if _, err := os.Stat(golden); errors.Is(err, fs.ErrNotExist) {
+				missing = append(missing, string(m[1]))
+			}
+		}
+	}
+	if len(missing) == 0 {
 		return nil
 	}
 
-	return printer.PrintFile(newFilename(gofile, fs.Package), fs, mode, *skipFormat)
+	tags := append([]string(nil), o.Tags...)
+	for _, tag := range testTags {
+		if !strings.HasPrefix(tag, "!") {
+			tags = append(tags, tag)
+		}
+	}
+	cmd := exec.Command("go", "test", "-count=1", "-tags="+strings.Join(tags, ","),
+		"-run=^TestGolden("+strings.Join(missing, "|")+")$", ".")
+	cmd.Dir = dir
+	cmd.Env = append(append(os.Environ(), env...), "MSGP_UPDATE_GOLDEN=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("writing the golden files of %s: %v\n%s", o.PkgPath, err, out)
+	}
+	for _, typ := range missing {
+		fmt.Printf(chalk.Magenta.Color(">>> Wrote golden file \"%s\"\n"), filepath.Join(dir, "testdata", "msgp", typ+".golden"))
+	}
+	return nil
+}
+
+// writeSchema writes the wire schema s to file as JSON.
+func writeSchema(file string, s *gen.Schema) error {
+	data, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	fmt.Printf(chalk.Magenta.Color(">>> Wrote schema \"%s\"\n"), file)
+	return nil
 }
 
-// picks a new file name based on input flags and input filename(s).
-func newFilename(old string, pkg string) string {
-	if *out != "" {
-		if pre := strings.TrimPrefix(*out, old); len(pre) > 0 &&
-			!strings.HasSuffix(*out, ".go") {
-			return filepath.Join(old, *out)
+// compat prints the changes between the schemas in the files
+// args[0] and args[1], and fails if any of them is breaking.
+func compat(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: msgp compat old.json new.json")
+	}
+	var schemas [2]gen.Schema
+	for i, file := range args {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &schemas[i]); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
 		}
-		return *out
 	}
+	changes := gen.Compat(&schemas[0], &schemas[1])
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+	if gen.Breaking(changes) {
+		return fmt.Errorf("breaking wire changes from %s to %s", args[0], args[1])
+	}
+	return nil
+}
+
+// checkWarnings fails with -Werror if
+// any warning was reported for fs.
+func checkWarnings(fs *parse.FileSet) error {
+	if n := fs.Count(parse.Warning); *werror && n > 0 {
+		return fmt.Errorf("%d warning(s) treated as errors (-Werror)", n)
+	}
+	return nil
+}
 
-	if fi, err := os.Stat(old); err == nil && fi.IsDir() {
-		old = filepath.Join(old, pkg)
+// Lint reports the constructs of the types in gofile, or in the
+// packages it matches, that threaten a canonical, bounded encoding,
+// and fails if it found any.
+func Lint(gofile string, unexported bool, warnPkgMask string) error {
+	fss, err := parse.Packages(context.Background(), []string{gofile}, unexported, warnPkgMask, loadOptions())
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, fs := range fss {
+		if err := checkWarnings(fs); err != nil {
+			return err
+		}
+		n += fs.Lint()
+	}
+	if n > 0 {
+		return fmt.Errorf("%d lint finding(s)", n)
+	}
+	return nil
+}
+
+// builds the options loading the input from the input flags;
+// diagnostics are printed to stderr as they are reported.
+func loadOptions() parse.LoadOptions {
+	return parse.LoadOptions{
+		Tags:        splitList(*buildTags),
+		Env:         splitList(*buildEnv),
+		Diagnostics: os.Stderr,
+		JSON:        *jsonDiags,
+	}
+}
+
+// builds the test file options from the input flags.
+func testOptions() (printer.TestOptions, error) {
+	var topts printer.TestOptions
+	if *testTempl != "" {
+		text, err := os.ReadFile(*testTempl)
+		if err != nil {
+			return topts, err
+		}
+		topts.Template, err = gen.ParseTestTemplate(filepath.Base(*testTempl), string(text))
+		if err != nil {
+			return topts, err
+		}
+	}
+	topts.Imports = splitList(*testImports)
+	topts.Tags = splitList(*testTags)
+	return topts, nil
+}
+
+// splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
-	// new file name is old file name + _gen.go
-	return strings.TrimSuffix(old, ".go") + "_gen.go"
+	return items
 }
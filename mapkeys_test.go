@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/algorand/msgp/gen"
+	"github.com/algorand/msgp/parse"
+)
+
+func printMethods(t *testing.T, file string, mode gen.Method) (string, error) {
+	fs, err := parse.File(file, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	var topics gen.Topics
+	err = fs.PrintTo(gen.NewPrinter(mode, &topics, &buf, nil))
+	return buf.String(), err
+}
+
+func TestMapKeySort(t *testing.T) {
+	out, err := printMethods(t, "testdata/mapkeys.go", gen.Marshal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"slices.Sort(",
+		"_buf[:0]",
+		"func(a, b Digest) int { return bytes.Compare(a[:], b[:]) }",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("generated code does not contain %q", want)
+		}
+	}
+	if strings.Contains(out, "sort.Sort(") {
+		t.Errorf("generated code sorts with an undefined sort.Interface")
+	}
+}
+
+func TestMapKeyUnordered(t *testing.T) {
+	if _, err := printMethods(t, "testdata/mapkeys_unordered.go", gen.Marshal); err == nil {
+		t.Fatal("expected an error for unordered map keys")
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/algorand/msgp/gen"
+	"github.com/algorand/msgp/parse"
+)
+
+func TestMaxSizeUnbounded(t *testing.T) {
+	fs, err := parse.File("testdata/maxsize_unbounded.go", true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var topics gen.Topics
+	if err := fs.PrintTo(gen.NewPrinter(gen.MaxSize, &topics, io.Discard, nil)); err == nil {
+		t.Fatal("expected an error for an unbounded type")
+	}
+	// the diagnostics name the unbounded field, and how to bound it
+	for _, want := range []string{
+		"MaxSize of Unbounded is unbounded at Unbounded.Names: slice has no allocbound; add an allocbound, or add a //msgp:unbounded Unbounded directive",
+		"MaxSize of Elems is unbounded at Elems.Names[]: string has no allocbound; bound the slice elements with the allocbound= part after that of the slice",
+		"MaxSize of Keys is unbounded at Keys.Counts[key]: string has no allocbound; bound the map keys with the allocbound= part after that of the map",
+	} {
+		found := false
+		for _, d := range fs.Diagnostics {
+			found = found || strings.Contains(d.Message, want)
+		}
+		if !found {
+			t.Errorf("no diagnostic %q in %v", want, fs.Diagnostics)
+		}
+	}
+}
+
+func TestMaxSizeChecked(t *testing.T) {
+	out, err := printMethods(t, "testdata/maxsize_checked.go", gen.MaxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"CheckedMaxSizeChecked() (s int, ok bool) {",
+		"return 0, false",
+		"BoundedMaxSize() (s int) {",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "panic(") {
+		t.Errorf("generated code panics:\n%s", out)
+	}
+}
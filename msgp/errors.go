@@ -25,6 +25,14 @@ func (e ErrNoField) Error() string {
 	return fmt.Sprintf("Unknown field: %s", string(e))
 }
 
+// ErrDuplicateField is returned when a message carries a
+// field more than once, under its wire key or an old one.
+type ErrDuplicateField string
+
+func (e ErrDuplicateField) Error() string {
+	return fmt.Sprintf("Duplicate field: %s", string(e))
+}
+
 type ErrTooManyArrayFields int
 
 func (e ErrTooManyArrayFields) Error() string {
@@ -344,6 +352,29 @@ func (e *ErrUnsupportedType) withContext(ctx string) error {
 	return &o
 }
 
+// FieldVersionError is returned when a message
+// contains a field that is not valid for the
+// protocol version being decoded.
+type FieldVersionError struct {
+	Field   string // the wire name of the field
+	Version uint64 // the version being decoded
+	ctx     string
+}
+
+// Error implements the error interface
+func (f FieldVersionError) Error() string {
+	out := fmt.Sprintf("msgp: field %q not allowed in version %d", f.Field, f.Version)
+	if f.ctx != "" {
+		out += " at " + f.ctx
+	}
+	return out
+}
+
+// Resumable is always 'true' for FieldVersionErrors
+func (f FieldVersionError) Resumable() bool { return true }
+
+func (f FieldVersionError) withContext(ctx string) error { f.ctx = addCtx(f.ctx, ctx); return f }
+
 // ErrMaxDepthExceeded is returned if the maximum traversal depth is exceeded.
 type ErrMaxDepthExceeded struct{}
 
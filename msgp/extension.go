@@ -204,6 +204,23 @@ func AppendExtension(b []byte, e Extension) ([]byte, error) {
 	return o, e.MarshalBinaryTo(o[n:])
 }
 
+// ExtensionEqual reports whether a and b have
+// the same MessagePack encoding.
+func ExtensionEqual(a Extension, b Extension) bool {
+	if a.ExtensionType() != b.ExtensionType() || a.Len() != b.Len() {
+		return false
+	}
+	ab, err := AppendExtension(nil, a)
+	if err != nil {
+		return false
+	}
+	bb, err := AppendExtension(nil, b)
+	if err != nil {
+		return false
+	}
+	return string(ab) == string(bb)
+}
+
 // ReadExtensionBytes reads an extension from 'b' into 'e'
 // and returns any remaining bytes.
 // Possible errors:
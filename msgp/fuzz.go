@@ -0,0 +1,29 @@
+package msgp
+
+import "runtime/metrics"
+
+// FuzzAllocLimit is the largest number of heap bytes that
+// the generated fuzz targets allow a single UnmarshalMsg
+// call to allocate. Decoding more than this from a small
+// input usually means that an allocbound is missing or
+// too generous.
+var FuzzAllocLimit uint64 = 64 << 20
+
+// allocatedBytesMetric is the total of heap bytes allocated.
+// Unlike runtime.ReadMemStats, reading it does not stop the
+// world, so it is cheap enough to read for every fuzz input.
+const allocatedBytesMetric = "/gc/heap/allocs:bytes"
+
+// AllocatedBytes returns the number of heap bytes that
+// were allocated while fn ran. Allocations made by other
+// goroutines in the meantime are counted as well. The
+// runtime counts small allocations a span at a time, so
+// the result may be off by a few kilobytes.
+func AllocatedBytes(fn func()) uint64 {
+	s := []metrics.Sample{{Name: allocatedBytesMetric}}
+	metrics.Read(s)
+	before := s[0].Value.Uint64()
+	fn()
+	metrics.Read(s)
+	return s[0].Value.Uint64() - before
+}
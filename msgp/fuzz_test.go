@@ -0,0 +1,15 @@
+package msgp
+
+import (
+	"testing"
+)
+
+var allocSink []byte
+
+func TestAllocatedBytes(t *testing.T) {
+	const size = 1 << 20
+	if n := AllocatedBytes(func() { allocSink = make([]byte, size) }); n < size || n > 2*size {
+		t.Errorf("allocating %d bytes counted %d", size, n)
+	}
+	allocSink = nil
+}
@@ -0,0 +1,18 @@
+package msgp
+
+// Msg constrains the pointer type parameters of generic
+// types with generated methods. Every type parameter that
+// such a type encodes needs a companion constrained by
+// Msg, through which its methods are called:
+//
+//	type Pair[K any, PK msgp.Msg[K], V any, PV msgp.Msg[V]] struct {
+//		Key   K `codec:"k"`
+//		Value V `codec:"v"`
+//	}
+type Msg[T any] interface {
+	*T
+	Marshaler
+	Unmarshaler
+	Sizer
+	MsgIsZero() bool
+}
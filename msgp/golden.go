@@ -0,0 +1,98 @@
+package msgp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GoldenValues is the number of pseudo-random
+// values whose encodings a golden file holds.
+const GoldenValues = 32
+
+const goldenHeader = `# Canonical MessagePack encodings of pseudo-random values, in hex,
+# each followed by the value as JSON, if it has a JSON encoding.
+# Written by msgp; rewrite with MSGP_UPDATE_GOLDEN=1 go test.
+`
+
+// CheckGolden checks that every encoding in the golden file
+// decodes into a T that re-encodes to the same bytes, so that
+// any change to the canonical encoding of T is caught. If update
+// is set, the file is written first, with the encodings of
+// GoldenValues pseudo-random values from a fixed seed; otherwise,
+// a missing file is an error, lest the check pass vacuously.
+// msgp -golden writes the files missing when it generates the tests.
+func CheckGolden[T any, PT interface {
+	*T
+	Marshaler
+	Unmarshaler
+	Randomizer
+}](file string, update bool) error {
+	if update {
+		if err := writeGolden[T, PT](file); err != nil {
+			return err
+		}
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("golden file %s does not exist; write it with msgp -golden, or MSGP_UPDATE_GOLDEN=1 go test", file)
+	}
+	if err != nil {
+		return err
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		enc, _, _ := strings.Cut(line, " ")
+		bts, err := hex.DecodeString(enc)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", file, i+1, err)
+		}
+		var v T
+		left, err := PT(&v).UnmarshalMsg(bts)
+		if err != nil {
+			return fmt.Errorf("%s:%d: decoding %s: %v", file, i+1, enc, err)
+		}
+		if len(left) > 0 {
+			return fmt.Errorf("%s:%d: %d bytes left over after decoding %s", file, i+1, len(left), enc)
+		}
+		if again := PT(&v).MarshalMsg(nil); !bytes.Equal(bts, again) {
+			return fmt.Errorf("%s:%d: %s is re-encoded as %x; its canonical encoding changed", file, i+1, enc, again)
+		}
+	}
+	return nil
+}
+
+// writeGolden writes the golden file of T.
+func writeGolden[T any, PT interface {
+	*T
+	Marshaler
+	Randomizer
+}](file string) error {
+	var b strings.Builder
+	b.WriteString(goldenHeader)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < GoldenValues; i++ {
+		var v T
+		PT(&v).RandomizeMsg(r, 4)
+		b.WriteString(hex.EncodeToString(PT(&v).MarshalMsg(nil)))
+		if js, err := json.Marshal(&v); err == nil {
+			b.WriteByte(' ')
+			b.Write(js)
+		}
+		b.WriteByte('\n')
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, []byte(b.String()), 0644)
+}
@@ -0,0 +1,45 @@
+package msgp
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckGolden(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "msgp", "Raw.golden")
+	if err := CheckGolden[Raw](file, false); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("CheckGolden accepted a missing file: %v", err)
+	}
+	if _, err := os.Stat(file); err == nil {
+		t.Fatalf("CheckGolden wrote %s without update", file)
+	}
+	if err := CheckGolden[Raw](file, true); err != nil {
+		t.Fatalf("writing %s: %v", file, err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "\n") - strings.Count(goldenHeader, "\n"); n != GoldenValues {
+		t.Fatalf("%s has %d values, want %d", file, n, GoldenValues)
+	}
+	if err := CheckGolden[Raw](file, false); err != nil {
+		t.Fatalf("checking %s: %v", file, err)
+	}
+
+	// trailing bytes are not a canonical encoding
+	if err := os.WriteFile(file, append(data, "c0c0\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckGolden[Raw](file, false); err == nil || !strings.Contains(err.Error(), "left over") {
+		t.Fatalf("CheckGolden accepted trailing bytes: %v", err)
+	}
+	if err := CheckGolden[Raw](file, true); err != nil {
+		t.Fatalf("updating %s: %v", file, err)
+	}
+	if again, _ := os.ReadFile(file); string(again) != string(data) {
+		t.Fatalf("%s is not deterministic", file)
+	}
+}
@@ -0,0 +1,98 @@
+package msgp
+
+import (
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+)
+
+// RandomMaxLen is the largest length chosen for randomized
+// strings, byte slices, slices and maps, regardless of
+// their allocbound.
+const RandomMaxLen = 8
+
+// RandomSeed returns the seed of the generated randomized
+// tests: the value of the MSGP_SEED environment variable, if
+// set, to reproduce a failure, and otherwise a seed that
+// varies between runs.
+func RandomSeed() int64 {
+	if seed, err := strconv.ParseInt(os.Getenv("MSGP_SEED"), 10, 64); err == nil {
+		return seed
+	}
+	return time.Now().UnixNano()
+}
+
+// RandomLen returns a random length that does not exceed
+// bound or RandomMaxLen. A negative bound means that the
+// length is unbounded.
+func RandomLen(r *rand.Rand, bound int) int {
+	if bound < 0 || bound > RandomMaxLen {
+		bound = RandomMaxLen
+	}
+	return r.Intn(bound + 1)
+}
+
+// RandomBool returns a random bool.
+func RandomBool(r *rand.Rand) bool {
+	return r.Intn(2) == 0
+}
+
+// RandomUint64 returns a random uint64. Its bit length is
+// chosen uniformly, so that every integer encoding width
+// (and zero) is exercised.
+func RandomUint64(r *rand.Rand) uint64 {
+	return r.Uint64() >> uint(r.Intn(65))
+}
+
+// RandomInt64 returns a random int64, with the same
+// distribution of bit lengths as RandomUint64.
+func RandomInt64(r *rand.Rand) int64 {
+	i := int64(RandomUint64(r) >> 1)
+	if RandomBool(r) {
+		return -i
+	}
+	return i
+}
+
+// RandomFloat64 returns a random, finite float64.
+func RandomFloat64(r *rand.Rand) float64 {
+	if r.Intn(4) == 0 {
+		return 0
+	}
+	return r.NormFloat64()
+}
+
+// RandomString returns a random string whose length
+// is chosen by RandomLen.
+func RandomString(r *rand.Rand, bound int) string {
+	b := make([]byte, RandomLen(r, bound))
+	for i := range b {
+		b[i] = byte('a' + r.Intn(26))
+	}
+	return string(b)
+}
+
+// RandomBytes returns a random, possibly nil, byte
+// slice whose length is chosen by RandomLen.
+func RandomBytes(r *rand.Rand, bound int) []byte {
+	if r.Intn(4) == 0 {
+		return nil
+	}
+	b := make([]byte, RandomLen(r, bound))
+	for i := range b {
+		b[i] = byte(r.Intn(256))
+	}
+	return b
+}
+
+// RandomTime returns a random time.
+func RandomTime(r *rand.Rand) time.Time {
+	return time.Unix(r.Int63n(1<<33), r.Int63n(int64(time.Second)))
+}
+
+// Randomizer is implemented by types with
+// generated RandomizeMsg methods.
+type Randomizer interface {
+	RandomizeMsg(r *rand.Rand, maxDepth int)
+}
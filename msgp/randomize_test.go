@@ -0,0 +1,28 @@
+package msgp
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestRandomLen(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		if n := RandomLen(r, 3); n < 0 || n > 3 {
+			t.Fatalf("RandomLen(r, 3) = %d", n)
+		}
+		if n := RandomLen(r, -1); n < 0 || n > RandomMaxLen {
+			t.Fatalf("RandomLen(r, -1) = %d", n)
+		}
+		if s := RandomString(r, 2); len(s) > 2 {
+			t.Fatalf("RandomString(r, 2) = %q", s)
+		}
+	}
+}
+
+func TestRandomSeed(t *testing.T) {
+	t.Setenv("MSGP_SEED", "42")
+	if seed := RandomSeed(); seed != 42 {
+		t.Errorf("RandomSeed() = %d with MSGP_SEED=42", seed)
+	}
+}
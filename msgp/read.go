@@ -85,6 +85,16 @@ type Unmarshaler interface {
 // UnmarshalState holds state while running UnmarshalMsg.
 type UnmarshalState struct {
 	AllowableDepth uint64
+
+	// Version is the protocol version being decoded. Fields tagged
+	// with since= or until= are rejected when they are not valid
+	// for this version. Zero disables version checks.
+	Version uint64
+
+	// Strict rejects field keys that a canonical encoder
+	// would never produce, such as the old name of a field
+	// that was renamed with an alias= tag part.
+	Strict bool
 }
 
 // DefaultUnmarshalState defines the default state.
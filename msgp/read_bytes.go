@@ -3,6 +3,7 @@ package msgp
 import (
 	"encoding/binary"
 	"math"
+	"math/rand"
 	"time"
 )
 
@@ -77,6 +78,12 @@ func (r Raw) MarshalMsg(b []byte) []byte {
 	return o
 }
 
+// MarshalMsgWithState implements msgp.MarshalerWithState.
+// Raw carries no fields, so the state is ignored.
+func (r Raw) MarshalMsgWithState(b []byte, st MarshalState) []byte {
+	return r.MarshalMsg(b)
+}
+
 // CanUnmarshalMsg returns true if the z interface is a Raw object ( part of the Unmarshaler interface )
 func (*Raw) CanUnmarshalMsg(z interface{}) bool {
 	_, ok := (z).(*Raw)
@@ -124,6 +131,24 @@ func (r Raw) Msgsize() int {
 	return l
 }
 
+// MsgCopy returns a copy of the raw contents of 'raw'.
+func (r *Raw) MsgCopy() Raw {
+	if *r == nil {
+		return nil
+	}
+	return append(Raw{}, *r...)
+}
+
+// MsgEqual reports whether r and o have the same encoding.
+func (r *Raw) MsgEqual(o *Raw) bool {
+	return string(*r) == string(*o)
+}
+
+// RandomizeMsg sets r to a random MessagePack integer.
+func (r *Raw) RandomizeMsg(rnd *rand.Rand, maxDepth int) {
+	*r = AppendUint64(nil, RandomUint64(rnd))
+}
+
 // MsgIsZero returns whether this is a zero value
 func (r *Raw) MsgIsZero() bool {
 	return len(*r) == 0
@@ -321,7 +346,7 @@ func ReadFloat64Bytes(b []byte) (f float64, o []byte, err error) {
 			f = float64(tf)
 			return
 		}
-		if b[0] == mnil {
+		if len(b) >= 1 && b[0] == mnil {
 			o = b[1:]
 			return
 		}
@@ -63,6 +63,15 @@ func BenchmarkReadFloat64Bytes(b *testing.B) {
 	}
 }
 
+func TestReadFloat64BytesShort(t *testing.T) {
+	buf := AppendFloat64(nil, 3.14159)
+	for i := 0; i < len(buf); i++ {
+		if _, _, err := ReadFloat64Bytes(buf[:i]); err != ErrShortBytes {
+			t.Errorf("ReadFloat64Bytes(%x) returned %v, expected ErrShortBytes", buf[:i], err)
+		}
+	}
+}
+
 func BenchmarkReadFloat32Bytes(b *testing.B) {
 	f := float32(3.14159)
 	buf := make([]byte, 0, 5)
@@ -0,0 +1,16 @@
+package msgp
+
+// InVersionRange reports whether a field introduced at
+// version since and retired at version until is valid at
+// version v. The range is half-open: since <= v < until.
+// A zero until means the field has not been retired, and
+// a zero v disables version checks altogether.
+func InVersionRange(v uint64, since uint64, until uint64) bool {
+	if v == 0 {
+		return true
+	}
+	if v < since {
+		return false
+	}
+	return until == 0 || v < until
+}
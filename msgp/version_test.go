@@ -0,0 +1,26 @@
+package msgp
+
+import (
+	"testing"
+)
+
+func TestInVersionRange(t *testing.T) {
+	cases := []struct {
+		v, since, until uint64
+		want            bool
+	}{
+		{0, 5, 7, true},
+		{4, 5, 7, false},
+		{5, 5, 7, true},
+		{6, 5, 7, true},
+		{7, 5, 7, false},
+		{100, 5, 0, true},
+		{1, 0, 2, true},
+		{2, 0, 2, false},
+	}
+	for _, c := range cases {
+		if got := InVersionRange(c.v, c.since, c.until); got != c.want {
+			t.Errorf("InVersionRange(%d, %d, %d) = %v, want %v", c.v, c.since, c.until, got, c.want)
+		}
+	}
+}
@@ -63,3 +63,24 @@ type Marshaler interface {
 	MarshalMsg([]byte) []byte
 	CanMarshalMsg(o interface{}) bool
 }
+
+// MarshalerWithState is implemented by the generated
+// Marshalers, whose MarshalMsgWithState appends the
+// marshalled form of the object for the protocol
+// version in the MarshalState. The generated code
+// marshals the Marshalers that do not implement it,
+// such as hand-written ones, with MarshalMsg.
+type MarshalerWithState interface {
+	MarshalMsgWithState([]byte, MarshalState) []byte
+}
+
+// MarshalState holds state while running MarshalMsg.
+type MarshalState struct {
+	// Version is the protocol version being encoded. Fields tagged
+	// with since= or until= are omitted when they are not valid
+	// for this version. Zero disables version checks.
+	Version uint64
+}
+
+// DefaultMarshalState defines the default state.
+var DefaultMarshalState = MarshalState{}
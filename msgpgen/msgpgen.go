@@ -0,0 +1,319 @@
+// Package msgpgen generates the MessagePack methods of Go types
+// like the msgp command, for tools that embed the generator.
+// The generated files are returned in memory, not written, and
+// every call of Generate has its own state, so that calls may
+// run concurrently.
+//
+// (The generator cannot live in package msgp itself, which is
+// the runtime library that the generated code imports.)
+package msgpgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/algorand/msgp/gen"
+	"github.com/algorand/msgp/parse"
+	"github.com/algorand/msgp/printer"
+)
+
+// Options are the options of Generate.
+type Options struct {
+	// Input is a file, a directory or a package pattern such
+	// as "./...". With PerFile, it may be a comma-separated
+	// list of them.
+	Input string
+
+	// Output names the generated file, if only one is generated.
+	// By default, the methods of x.go are generated to x_gen.go,
+	// and those of a package directory to <package>_gen.go.
+	Output string
+
+	// Mode selects the methods and tests to generate.
+	Mode gen.Method
+
+	// Unexported also processes unexported types.
+	Unexported bool
+
+	// WarnPkgMask skips warnings on types
+	// outside of the given package.
+	WarnPkgMask string
+
+	// PerFile generates the types declared in each input
+	// file to its own _gen.go file.
+	PerFile bool
+
+	// Load controls how the input is loaded, and
+	// where its diagnostics are printed as they are
+	// reported, if anywhere.
+	Load parse.LoadOptions
+
+	// TagSets, if any, generate the input once for every
+	// set of build tags, loaded with its tags that are
+	// not negated, to files that require the whole set
+	// and are named after it, as x_linux_notrocksdb_gen.go
+	// for the set linux,!rocksdb.
+	TagSets [][]string
+
+	Format printer.FormatOptions
+	Test   printer.TestOptions
+
+	// Plugins generate extra code for every type,
+	// after its methods, in the same file.
+	Plugins []gen.Plugin
+}
+
+// A Result holds the outputs of Generate.
+type Result struct {
+	Outputs []Output
+
+	// Diagnostics are those of the packages generated,
+	// in the order of Outputs.
+	Diagnostics []parse.Diagnostic
+}
+
+// An Output is a file generated for a package, and its tests.
+type Output struct {
+	PkgPath string // path of the package
+	File    string // the generated file
+
+	// Files are the generated file and its test file, if
+	// Mode generates tests. Files is empty if the package
+	// declares no types requiring code generation.
+	Files []printer.Rendered
+
+	// Topics are the methods generated for each type,
+	// and Schema is the wire schema of the types.
+	Topics map[string][]string
+	Schema *gen.Schema
+
+	// Tags are the build tags the package was loaded
+	// with, which the generated files build with.
+	Tags []string
+}
+
+// Count returns the number of diagnostics
+// of r with at least severity sev.
+func (r *Result) Count(sev parse.Severity) int {
+	n := 0
+	for _, d := range r.Diagnostics {
+		if d.Severity >= sev {
+			n++
+		}
+	}
+	return n
+}
+
+// Generate generates the methods of the types of opts.Input.
+// Independent packages are generated in parallel. If some of
+// them fail, the Result still holds the others, and the
+// diagnostics of all of them.
+func Generate(ctx context.Context, opts Options) (Result, error) {
+	var res Result
+	if len(opts.TagSets) == 0 {
+		err := generateSet(ctx, opts, opts.Load, nil, &res)
+		return res, err
+	}
+	for _, set := range opts.TagSets {
+		// the generated files require every tag of the set,
+		// and are loaded with the tags that are not negated
+		lopts := opts.Load
+		lopts.Tags = append([]string(nil), opts.Load.Tags...)
+		for _, tag := range set {
+			if !strings.HasPrefix(tag, "!") {
+				lopts.Tags = append(lopts.Tags, tag)
+			}
+		}
+		if err := generateSet(ctx, opts, lopts, set, &res); err != nil {
+			return res, fmt.Errorf("tag set %s: %w", strings.Join(set, ","), err)
+		}
+	}
+	return res, nil
+}
+
+// generateSet generates the input, loaded with lopts, and
+// adds the outputs to res. If constraint is non-empty, the
+// files generated require its tags, and are named after them.
+func generateSet(ctx context.Context, opts Options, lopts parse.LoadOptions, constraint []string, res *Result) error {
+	patterns, only := []string{opts.Input}, map[string]bool(nil)
+	if opts.PerFile {
+		patterns, only = perFileInputs(opts.Input)
+	}
+	fss, err := parse.Packages(ctx, patterns, opts.Unexported, opts.WarnPkgMask, lopts)
+	if err != nil {
+		return err
+	}
+	outs := make([][]output, len(fss))
+	n := 0
+	for i, fs := range fss {
+		outs[i] = outputs(opts, fs, len(fss) > 1, only)
+		for j := range outs[i] {
+			outs[i][j].file = tagSetFilename(outs[i][j].file, constraint)
+		}
+		n += len(outs[i])
+	}
+	if n > 1 && opts.Output != "" {
+		return fmt.Errorf("Output names a single file, but %s generates %d files", opts.Input, n)
+	}
+
+	fopts := opts.Format
+	fopts.Tags = append(append([]string(nil), opts.Format.Tags...), constraint...)
+
+	// the outputs of a package share its types,
+	// so only distinct packages run in parallel
+	results := make([][]Output, len(fss))
+	errs := make([]error, len(fss))
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	var wg sync.WaitGroup
+	for i := range fss {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			for _, o := range outs[i] {
+				if errs[i] = ctx.Err(); errs[i] != nil {
+					return
+				}
+				out := Output{PkgPath: o.fs.PkgPath, File: o.file, Schema: o.fs.Schema(), Tags: lopts.Tags}
+				if len(o.fs.Identities) > 0 {
+					files, topics, err := printer.Render(o.file, o.fs, opts.Mode, fopts, opts.Test, opts.Plugins)
+					if err != nil {
+						errs[i] = err
+						return
+					}
+					out.Files, out.Topics = files, topics.Structs()
+				}
+				results[i] = append(results[i], out)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, fs := range fss {
+		res.Outputs = append(res.Outputs, results[i]...)
+		// the directives of the generators are only
+		// applied while printing each output
+		res.Diagnostics = append(res.Diagnostics, fs.Diagnostics...)
+		for _, o := range outs[i] {
+			if o.fs != fs {
+				res.Diagnostics = append(res.Diagnostics, o.fs.Diagnostics...)
+			}
+		}
+	}
+	if len(fss) == 1 {
+		return errs[0]
+	}
+	for i, err := range errs {
+		if err != nil {
+			errs[i] = fmt.Errorf("%s: %w", fss[i].PkgPath, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// An output is a file to generate the methods of fs to.
+type output struct {
+	file string
+	fs   *parse.FileSet
+}
+
+// outputs returns the outputs of the package fs, loaded from
+// the input along with other packages if multi is set. With
+// PerFile, every file declaring types of fs has its own
+// output, unless only lists other files of the package.
+func outputs(opts Options, fs *parse.FileSet, multi bool, only map[string]bool) []output {
+	if !opts.PerFile {
+		in := opts.Input
+		if _, err := os.Stat(in); multi || err != nil {
+			// a package pattern or import path is not a
+			// file, even if it matches a single package
+			in = fs.Dir
+		}
+		return []output{{file: newFilename(in, fs.Package, opts.Output), fs: fs}}
+	}
+	filter := false
+	for file := range only {
+		filter = filter || filepath.Dir(file) == fs.Dir
+	}
+	var outs []output
+	for _, file := range fs.DeclFiles() {
+		if filter && !only[file] {
+			continue
+		}
+		name := file
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, file); err == nil && !strings.HasPrefix(rel, "..") {
+				name = rel
+			}
+		}
+		outs = append(outs, output{file: newFilename(name, fs.Package, opts.Output), fs: fs.DeclaredIn(file)})
+	}
+	return outs
+}
+
+// perFileInputs splits the comma-separated inputs of PerFile
+// into the package patterns to load, and the absolute paths of
+// the input files, if any, whose types are generated. A file
+// is loaded with the rest of the package in its directory.
+func perFileInputs(input string) (patterns []string, only map[string]bool) {
+	only = make(map[string]bool)
+	seen := make(map[string]bool)
+	for _, in := range strings.Split(input, ",") {
+		if in = strings.TrimSpace(in); in == "" {
+			continue
+		}
+		pattern := in
+		if strings.HasSuffix(in, ".go") {
+			if abs, err := filepath.Abs(in); err == nil {
+				only[abs] = true
+			}
+			pattern = filepath.Dir(in)
+			if !filepath.IsAbs(pattern) && !strings.HasPrefix(pattern, ".") {
+				pattern = "." + string(filepath.Separator) + pattern
+			}
+		}
+		if !seen[pattern] {
+			seen[pattern] = true
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns, only
+}
+
+// names the generated file after the tags of the tag set
+// it is generated for, e.g. x_gen.go becomes x_notwindows_gen.go
+// for the tag set "!windows".
+func tagSetFilename(file string, constraint []string) string {
+	if len(constraint) == 0 {
+		return file
+	}
+	name := strings.ReplaceAll(strings.Join(constraint, "_"), "!", "not")
+	if strings.HasSuffix(file, "_gen.go") {
+		return strings.TrimSuffix(file, "_gen.go") + "_" + name + "_gen.go"
+	}
+	return strings.TrimSuffix(file, ".go") + "_" + name + ".go"
+}
+
+// picks a new file name based on the output option and input filename(s).
+func newFilename(old string, pkg string, out string) string {
+	if out != "" {
+		if pre := strings.TrimPrefix(out, old); len(pre) > 0 &&
+			!strings.HasSuffix(out, ".go") {
+			return filepath.Join(old, out)
+		}
+		return out
+	}
+
+	if fi, err := os.Stat(old); err == nil && fi.IsDir() {
+		old = filepath.Join(old, pkg)
+	}
+	// new file name is old file name + _gen.go
+	return strings.TrimSuffix(old, ".go") + "_gen.go"
+}
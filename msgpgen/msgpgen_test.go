@@ -0,0 +1,271 @@
+package msgpgen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/algorand/msgp/gen"
+)
+
+func TestGenerate(t *testing.T) {
+	opts := Options{
+		Input:      "../testdata/pkgs/...",
+		Mode:       gen.Marshal | gen.Unmarshal | gen.Size | gen.MaxSize | gen.Test,
+		Unexported: true,
+	}
+
+	// concurrent calls share no state, and agree
+	var wg sync.WaitGroup
+	results := make([]Result, 4)
+	errs := make([]error, len(results))
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = Generate(context.Background(), opts)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	res := results[0]
+	if len(res.Outputs) != 3 {
+		t.Fatalf("%d outputs, expected a, b and tagged", len(res.Outputs))
+	}
+	a := res.Outputs[0]
+	if !strings.HasSuffix(a.File, filepath.FromSlash("testdata/pkgs/a/a_gen.go")) {
+		t.Errorf("a is generated to %s", a.File)
+	}
+	if len(a.Files) != 2 || len(a.Topics["A"]) == 0 {
+		t.Errorf("a generates %d files, and methods %v for A", len(a.Files), a.Topics["A"])
+	}
+	if _, err := os.Stat(a.File); err == nil {
+		t.Errorf("Generate wrote %s", a.File)
+	}
+	for _, other := range results[1:] {
+		for i, o := range other.Outputs {
+			for j, f := range o.Files {
+				if !bytes.Equal(f.Data, res.Outputs[i].Files[j].Data) {
+					t.Errorf("concurrent calls generated different %s", f.File)
+				}
+			}
+		}
+	}
+}
+
+func TestGeneratePattern(t *testing.T) {
+	// a pattern matching a single package is
+	// generated to the directory of the package
+	res, err := Generate(context.Background(), Options{
+		Input:      "../testdata/pkgs/b/...",
+		Mode:       gen.Marshal | gen.Unmarshal | gen.Size,
+		Unexported: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Outputs) != 1 || !strings.HasSuffix(res.Outputs[0].File, filepath.FromSlash("testdata/pkgs/b/b_gen.go")) {
+		t.Fatalf("outputs %+v, expected testdata/pkgs/b/b_gen.go", res.Outputs)
+	}
+}
+
+func TestGenerateTagSets(t *testing.T) {
+	res, err := Generate(context.Background(), Options{
+		Input:      "../testdata/pkgs/tagged",
+		Mode:       gen.Marshal | gen.Unmarshal,
+		Unexported: true,
+		TagSets:    [][]string{{"msgptag"}, {"!msgptag"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Outputs) != 2 {
+		t.Fatalf("%d outputs, expected one per tag set", len(res.Outputs))
+	}
+	if _, ok := res.Outputs[0].Topics["Tagged"]; !ok {
+		t.Errorf("Tagged was not generated with msgptag")
+	}
+	if _, ok := res.Outputs[1].Topics["Tagged"]; ok {
+		t.Errorf("Tagged was generated without msgptag")
+	}
+	if got := tagSetFilename("x_gen.go", []string{"linux", "!rocksdb"}); got != "x_linux_notrocksdb_gen.go" {
+		t.Errorf("tag set file name %s", got)
+	}
+}
+
+// fieldNames is a plugin writing a FieldNames
+// method for every struct.
+type fieldNames struct {
+	gen.Passes
+	w *gen.Writer
+}
+
+func (f *fieldNames) Method() gen.Method { return gen.Marshal }
+
+func (f *fieldNames) Execute(e gen.Elem) ([]gen.Diagnostic, error) {
+	e = f.ApplyAll(e)
+	s, ok := e.(*gen.Struct)
+	if !ok {
+		return nil, f.w.Err()
+	}
+	s = s.Copy().(*gen.Struct)
+	names := f.w.Ident()
+	f.w.Printf("\nfunc (%s %s) FieldNames() []string {", s.Varname(), gen.MethodReceiver(s))
+	f.w.Printf("\nvar %s []string", names)
+	for _, fld := range s.Fields {
+		if fld.FieldName == "_struct" {
+			continue
+		}
+		f.w.Printf("\n%s = append(%s, %q)", names, names, fld.FieldTag)
+	}
+	f.w.Printf("\nreturn %s", names)
+	f.w.CloseBlock()
+	return nil, f.w.Err()
+}
+
+func TestGeneratePlugin(t *testing.T) {
+	res, err := Generate(context.Background(), Options{
+		Input:      "../testdata/pkgs/b",
+		Mode:       gen.Marshal | gen.Unmarshal,
+		Unexported: true,
+		Plugins: []gen.Plugin{func(w *gen.Writer, topics *gen.Topics) gen.Generator {
+			return &fieldNames{w: w}
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := string(res.Outputs[0].Files[0].Data)
+	if !strings.Contains(src, "func (z *B) FieldNames() []string {") {
+		t.Errorf("the plugin generated no FieldNames method:\n%s", src)
+	}
+	if strings.Index(src, "FieldNames") < strings.Index(src, "func (z *B) UnmarshalMsg") {
+		t.Errorf("FieldNames precedes the methods of B")
+	}
+}
+
+func TestGenerateRandomize(t *testing.T) {
+	for _, mode := range []gen.Method{gen.Test, gen.Test | gen.Randomize} {
+		res, err := Generate(context.Background(), Options{
+			Input:      "../testdata/pkgs/b",
+			Mode:       gen.Marshal | gen.Unmarshal | gen.Size | mode,
+			Unexported: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		src, tests := string(res.Outputs[0].Files[0].Data), string(res.Outputs[0].Files[1].Data)
+		explicit := mode&gen.Randomize != 0
+		if got := strings.Contains(src, "RandomizeMsg(r *rand.Rand"); got != explicit {
+			t.Errorf("with -randomize %v, the generated file declares RandomizeMsg: %v", explicit, got)
+		}
+		if got := strings.Contains(src, `"math/rand"`); got != explicit {
+			t.Errorf("with -randomize %v, the generated file imports math/rand: %v", explicit, got)
+		}
+		if got := strings.Contains(tests, "RandomizeMsg(r *rand.Rand"); got == explicit {
+			t.Errorf("with -randomize %v, the tests declare RandomizeMsg: %v", explicit, got)
+		}
+	}
+}
+
+// parallelPkg is a package generated in parallel with copies
+// of itself. Its directives, and the many temporaries of its
+// nested containers, exercise the state of the generator.
+const parallelPkg = `package %s
+
+//msgp:sort Key SortKey
+//msgp:unbounded Blob Record
+//msgp:allocbound Inner 8
+//msgp:ignore SortKey
+
+// Key is a map key ordered by SortKey.
+type Key float64
+
+type SortKey []Key
+
+func (s SortKey) Len() int           { return len(s) }
+func (s SortKey) Less(i, j int) bool { return s[i] < s[j] }
+func (s SortKey) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+type Blob []byte
+
+type Inner map[Key]uint64
+
+type Pair struct {
+	_struct struct{} ` + "`codec:\",omitempty,omitemptyarray\"`" + `
+
+	A *uint64  ` + "`codec:\"a\"`" + `
+	B []string ` + "`codec:\"b,allocbound=4,allocbound=16\"`" + `
+}
+
+type Record struct {
+	_struct struct{} ` + "`codec:\",omitempty,omitemptyarray\"`" + `
+
+	ByKey  map[Key]string   ` + "`codec:\"k,allocbound=8,allocbound=-,allocbound=16\"`" + `
+	Rows   [][]uint64       ` + "`codec:\"r,allocbound=8,allocbound=8\"`" + `
+	Inners map[string]Inner ` + "`codec:\"i,allocbound=8,allocbound=16\"`" + `
+	Pairs  [4]Pair          ` + "`codec:\"p\"`" + `
+	Blob   Blob             ` + "`codec:\"b\"`" + `
+}
+`
+
+func TestGenerateParallel(t *testing.T) {
+	dir, err := os.MkdirTemp(filepath.Join("..", "testdata"), "parallel-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for i := 0; i < 8; i++ {
+		pkg := fmt.Sprintf("p%d", i)
+		if err := os.Mkdir(filepath.Join(dir, pkg), 0755); err != nil {
+			t.Fatal(err)
+		}
+		src := fmt.Sprintf(parallelPkg, pkg)
+		if err := os.WriteFile(filepath.Join(dir, pkg, pkg+".go"), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := Options{
+		Input: filepath.ToSlash(dir) + "/...",
+		Mode: gen.Marshal | gen.Unmarshal | gen.Size | gen.IsZero | gen.MaxSize | gen.Copy | gen.Equal |
+			gen.Randomize | gen.Test | gen.Fuzz | gen.Golden,
+		Unexported: true,
+	}
+	// Generate runs up to GOMAXPROCS packages at once
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+	res, err := Generate(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Outputs) != 8 {
+		t.Fatalf("%d outputs, expected 8", len(res.Outputs))
+	}
+
+	// the packages generated in parallel are generated
+	// as they are alone; run with -race to check that
+	// they share no state
+	for _, o := range res.Outputs {
+		alone := opts
+		alone.Input = filepath.Dir(o.File)
+		want, err := Generate(context.Background(), alone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, f := range o.Files {
+			if !bytes.Equal(f.Data, want.Outputs[0].Files[i].Data) {
+				t.Errorf("%s generated in parallel differs from %s generated alone", f.File, want.Outputs[0].Files[i].File)
+			}
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/algorand/msgp/parse"
+)
+
+func TestPackages(t *testing.T) {
+	fss, err := parse.Packages(context.Background(), []string{"./testdata/pkgs/b", "./testdata/pkgs/a"}, true, "", parse.LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fss) != 2 || fss[0].Package != "a" || fss[1].Package != "b" {
+		t.Fatalf("got %d packages, expected a and b", len(fss))
+	}
+	a, b := fss[0], fss[1]
+	if b.ImportSet[a.PkgPath] != a {
+		t.Errorf("b does not share the FileSet of a")
+	}
+	if _, ok := b.Identities["B"]; !ok {
+		t.Errorf("B was not parsed")
+	}
+}
+
+func TestDeclaredIn(t *testing.T) {
+	fs, err := parse.File("./testdata/pkgs/a", true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := fs.DeclFiles()
+	if len(files) != 2 || filepath.Base(files[0]) != "a.go" || filepath.Base(files[1]) != "a2.go" {
+		t.Fatalf("types declared in %v, expected a.go and a2.go", files)
+	}
+	a2 := fs.DeclaredIn("testdata/pkgs/a/a2.go")
+	if len(a2.Identities) != 1 || a2.Identities["A2"] == nil {
+		t.Errorf("a2.go declares %d types, expected A2", len(a2.Identities))
+	}
+	if len(fs.Identities) != 2 {
+		t.Errorf("DeclaredIn changed the identities of the package")
+	}
+}
+
+func TestPackagesTags(t *testing.T) {
+	for _, tags := range [][]string{nil, {"msgptag"}} {
+		fss, err := parse.Packages(context.Background(), []string{"./testdata/pkgs/tagged"}, true, "", parse.LoadOptions{Tags: tags})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := fss[0].Identities["Tagged"]; ok != (tags != nil) {
+			t.Errorf("with tags %v, Tagged was parsed: %v", tags, ok)
+		}
+	}
+}
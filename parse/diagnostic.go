@@ -0,0 +1,152 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Severity is the severity of a Diagnostic.
+type Severity int
+
+const (
+	Info    Severity = iota // informational, such as an applied directive
+	Warning                 // input that is ignored, or may not generate correct code
+	Error                   // input for which methods cannot be generated
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	default:
+		return "<invalid>"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *Severity) UnmarshalText(text []byte) error {
+	for _, sev := range []Severity{Info, Warning, Error} {
+		if string(text) == sev.String() {
+			*s = sev
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity %q", text)
+}
+
+// A Diagnostic is a message about the input,
+// at the position in the source it concerns.
+// File, Line and Column are empty if the
+// position is not known.
+type Diagnostic struct {
+	File     string   `json:"file,omitempty"`
+	Line     int      `json:"line,omitempty"`
+	Column   int      `json:"column,omitempty"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// String returns the diagnostic in the
+// form file:line:col: severity: message.
+func (d Diagnostic) String() string {
+	pos := token.Position{Filename: d.File, Line: d.Line, Column: d.Column}
+	if !pos.IsValid() {
+		return fmt.Sprintf("%s: %s", d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", pos, d.Severity, d.Message)
+}
+
+// a diagSink prints the diagnostics of the FileSets
+// loaded together, which may be printed in parallel
+type diagSink struct {
+	mu   sync.Mutex
+	w    io.Writer
+	json bool
+}
+
+// Count returns the number of diagnostics
+// of f with at least severity sev.
+func (f *FileSet) Count(sev Severity) int {
+	n := 0
+	for _, d := range f.Diagnostics {
+		if d.Severity >= sev {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *FileSet) infof(pos token.Pos, format string, v ...interface{}) {
+	f.report(Info, pos, format, v...)
+}
+
+func (f *FileSet) warnf(pos token.Pos, format string, v ...interface{}) {
+	f.report(Warning, pos, format, v...)
+}
+
+func (f *FileSet) errorf(pos token.Pos, format string, v ...interface{}) {
+	f.report(Error, pos, format, v...)
+}
+
+// report records a diagnostic at pos, prefixed with
+// the logging context, in f, and prints it if f was
+// loaded with LoadOptions.Diagnostics, unless its
+// severity is masked by the print level.
+func (f *FileSet) report(sev Severity, pos token.Pos, format string, v ...interface{}) {
+	if !f.print(int(sev)) {
+		return
+	}
+	d := Diagnostic{Severity: sev}
+	if f.fset != nil && pos.IsValid() {
+		p := f.fset.Position(pos)
+		d.File, d.Line, d.Column = relative(p.Filename), p.Line, p.Column
+	}
+	msg := make([]string, 0, len(f.logctx)+1)
+	msg = append(msg, f.logctx...)
+	d.Message = strings.Join(append(msg, fmt.Sprintf(format, v...)), ": ")
+
+	f.Diagnostics = append(f.Diagnostics, d)
+	if f.diag == nil || f.diag.w == nil {
+		return
+	}
+	f.diag.mu.Lock()
+	defer f.diag.mu.Unlock()
+	if f.diag.json {
+		b, err := json.Marshal(d)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Fprintf(f.diag.w, "%s\n", b)
+	} else {
+		fmt.Fprintln(f.diag.w, d)
+	}
+}
+
+// relative returns the path of file relative to
+// the working directory, if file is inside it.
+func relative(file string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return file
+	}
+	rel, err := filepath.Rel(wd, file)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return file
+	}
+	return rel
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"go/ast"
+	"go/token"
 	"strings"
 
 	"github.com/algorand/msgp/gen"
@@ -14,8 +15,8 @@ const linePrefix = "//msgp:"
 // func(args, fileset)
 type directive func([]string, *FileSet) error
 
-// func(passName, args, printer)
-type passDirective func(gen.Method, []string, *gen.Printer) error
+// func(passName, args, printer, fileset)
+type passDirective func(gen.Method, []string, *gen.Printer, *FileSet) error
 
 // map of all recognized directives
 //
@@ -27,6 +28,7 @@ var directives = map[string]directive{
 	"tuple":      astuple,
 	"sort":       sortintf,
 	"allocbound": allocbound,
+	"unbounded":  unbounded,
 	// _postunmarshalcheck is used to add callbacks to the end of un-marshalling that are tied to a specific Element.
 	_postunmarshalcheck: postunmarshalcheck,
 }
@@ -65,27 +67,30 @@ var passDirectives = map[string]passDirective{
 	"ignore": passignore,
 }
 
-func passignore(m gen.Method, text []string, p *gen.Printer) error {
-	pushstate(m.String())
+func passignore(m gen.Method, text []string, p *gen.Printer, f *FileSet) error {
+	f.pushstate(m.String())
 	for _, a := range text {
 		p.ApplyDirective(m, gen.IgnoreTypename(a))
-		infof("ignoring %s\n", a)
+		f.infof(f.dirPos, "ignoring %s", a)
 	}
-	popstate()
+	f.popstate()
 	return nil
 }
 
-// find all comment lines that begin with //msgp:
-func yieldComments(c []*ast.CommentGroup) []string {
+// find all comment lines that begin with //msgp:,
+// and their positions
+func yieldComments(c []*ast.CommentGroup) ([]string, []token.Pos) {
 	var out []string
+	var pos []token.Pos
 	for _, cg := range c {
 		for _, line := range cg.List {
 			if strings.HasPrefix(line.Text, linePrefix) {
 				out = append(out, strings.TrimPrefix(line.Text, linePrefix))
+				pos = append(pos, line.Pos())
 			}
 		}
 	}
-	return out
+	return out, pos
 }
 
 //msgp:shim {Type} as:{Newtype} using:{toFunc/fromFunc} mode:{Mode}
@@ -124,7 +129,7 @@ func applyShim(text []string, f *FileSet) error {
 		}
 	}
 
-	infof("%s -> %s\n", name, be.Value.String())
+	f.infof(f.dirPos, "%s -> %s", name, be.Value.String())
 	f.findShim(name, be)
 
 	return nil
@@ -139,7 +144,7 @@ func ignore(text []string, f *FileSet) error {
 		name := strings.TrimSpace(item)
 		if _, ok := f.Identities[name]; ok {
 			delete(f.Identities, name)
-			infof("ignoring %s\n", name)
+			f.infof(f.dirPos, "ignoring %s", name)
 		}
 	}
 	return nil
@@ -155,9 +160,9 @@ func astuple(text []string, f *FileSet) error {
 		if el, ok := f.Identities[name]; ok {
 			if st, ok := el.(*gen.Struct); ok {
 				st.AsTuple = true
-				infoln(name)
+				f.infof(f.dirPos, "%s", name)
 			} else {
-				warnf("%s: only structs can be tuples\n", name)
+				f.warnf(f.dirPos, "%s: only structs can be tuples", name)
 			}
 		}
 	}
@@ -171,8 +176,18 @@ func sortintf(text []string, f *FileSet) error {
 	}
 	sortType := strings.TrimSpace(text[1])
 	sortIntf := strings.TrimSpace(text[2])
-	gen.SetSortInterface(sortType, sortIntf)
-	infof("sorting %s using %s\n", sortType, sortIntf)
+	f.registry.SetSortInterface(sortType, sortIntf)
+	f.infof(f.dirPos, "sorting %s using %s", sortType, sortIntf)
+	return nil
+}
+
+//msgp:unbounded {TypeA} {TypeB}...
+func unbounded(text []string, f *FileSet) error {
+	for _, item := range text[1:] {
+		name := strings.TrimSpace(item)
+		f.registry.SetUnbounded(name)
+		f.infof(f.dirPos, "%s is unbounded", name)
+	}
 	return nil
 }
 
@@ -185,10 +200,10 @@ func allocbound(text []string, f *FileSet) error {
 	allocBound := strings.TrimSpace(text[2])
 	t, ok := f.Identities[allocBoundType]
 	if !ok {
-		warnf("allocbound: cannot find type %s\n", allocBoundType)
+		f.warnf(f.dirPos, "allocbound: cannot find type %s", allocBoundType)
 	} else {
 		t.SetAllocBound(allocBound)
-		infof("allocbound(%s): setting to %s\n", allocBoundType, allocBound)
+		f.infof(f.dirPos, "allocbound(%s): setting to %s", allocBoundType, allocBound)
 	}
 	return nil
 }
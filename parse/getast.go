@@ -1,14 +1,19 @@
 package parse
 
 import (
+	"context"
 	"fmt"
 	"go/ast"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
 
 	"github.com/algorand/msgp/gen"
-	"github.com/ttacon/chalk"
 	"golang.org/x/tools/go/packages"
 )
 
@@ -17,6 +22,7 @@ import (
 type FileSet struct {
 	Package    string              // package name
 	PkgPath    string              // package path
+	Dir        string              // directory of the package files
 	Specs      map[string]ast.Expr // type specs in file
 	Aliases    map[string]ast.Expr // type aliases in file
 	Interfaces map[string]ast.Expr // type interfaces in file
@@ -26,6 +32,37 @@ type FileSet struct {
 	Imports    []*ast.ImportSpec   // imports
 	ImportSet  ImportSet
 	ImportName map[string]string
+	TypeParams map[string]*ast.FieldList // type parameters of generic specs
+
+	// the type parameters in scope while a generic spec is
+	// parsed, mapped to their pointer type parameters
+	typeParams map[string]string
+
+	// type-checker information for the package,
+	// used to resolve identifiers through aliases
+	typesInfo *types.Info
+
+	// Diagnostics are reported while parsing
+	// and printing, at positions in fset
+	Diagnostics []Diagnostic
+	fset        *token.FileSet
+
+	// the positions of Directives, and of
+	// the directive being applied
+	dirPositions []token.Pos
+	dirPos       token.Pos
+
+	// the logging context prefixing diagnostics, and the
+	// number of severities masked by the print level; kept
+	// per FileSet, as packages are printed in parallel
+	logctx     []string
+	printlevel int
+
+	// shared by the FileSets loaded together: the types
+	// registered by directives, and the printing of
+	// diagnostics
+	registry *gen.Registry
+	diag     *diagSink
 }
 
 // An ImportSet describes the FileSets for a group of imported packages
@@ -38,43 +75,103 @@ type ImportSet map[string]*FileSet
 // If unexport is false, only exported identifiers are included in the FileSet.
 // If the resulting FileSet would be empty, an error is returned.
 func File(name string, unexported bool, warnPkgMask string) (*FileSet, error) {
-	pushstate(name)
-	defer popstate()
+	fss, err := Packages(context.Background(), []string{name}, unexported, warnPkgMask, LoadOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if len(fss) != 1 {
+		return nil, fmt.Errorf("multiple packages in directory: %s", name)
+	}
+	return fss[0], nil
+}
+
+// LoadOptions controls which files of a package are
+// loaded, and where their diagnostics are printed.
+type LoadOptions struct {
+	// Tags are the build tags satisfied while
+	// loading, as with go build -tags.
+	Tags []string
+
+	// Env holds KEY=VALUE pairs, such as GOOS=windows,
+	// added to the environment of the go command.
+	Env []string
+
+	// Diagnostics, if non-nil, is printed every Diagnostic
+	// as it is reported, as text or, if JSON is set, as
+	// one JSON object per line. Diagnostics are recorded
+	// in the FileSets either way.
+	Diagnostics io.Writer
+	JSON        bool
+}
 
+// Packages parses the packages matching patterns, such as
+// "./..." or the files and directories accepted by File, and
+// returns their FileSets, sorted by package path. The packages
+// and their dependencies are loaded once, and share an ImportSet,
+// so a package imported by several others is only parsed once.
+// The FileSets share no state with those of other calls, so
+// Packages may be called concurrently.
+func Packages(ctx context.Context, patterns []string, unexported bool, warnPkgMask string, lopts LoadOptions) ([]*FileSet, error) {
 	cfg := &packages.Config{
-		Mode: packages.NeedName | packages.NeedImports | packages.NeedDeps | packages.NeedSyntax | packages.NeedFiles | packages.NeedExportsFile | packages.NeedTypesInfo,
+		Context: ctx,
+		Mode:    packages.NeedName | packages.NeedImports | packages.NeedDeps | packages.NeedSyntax | packages.NeedFiles | packages.NeedExportsFile | packages.NeedTypesInfo,
+		Fset:    token.NewFileSet(),
+	}
+	if len(lopts.Tags) > 0 {
+		cfg.BuildFlags = []string{"-tags=" + strings.Join(lopts.Tags, ",")}
+	}
+	if len(lopts.Env) > 0 {
+		cfg.Env = append(os.Environ(), lopts.Env...)
 	}
 
-	pkgs, err := packages.Load(cfg, name)
+	pkgs, err := packages.Load(cfg, patterns...)
 	if err != nil {
 		return nil, err
 	}
-
-	if len(pkgs) != 1 {
-		return nil, fmt.Errorf("multiple packages in directory: %s", name)
-	}
-
-	var one *packages.Package
-	for _, nm := range pkgs {
-		one = nm
-		break
+	if len(pkgs) == 0 {
+		return nil, fmt.Errorf("no packages matching %s", strings.Join(patterns, " "))
 	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].PkgPath < pkgs[j].PkgPath })
 
+	// the FileSet of a package is shared by the packages
+	// importing it, including the other packages loaded
 	imps := make(map[string]*FileSet)
-
-	fs := packageToFileSet(one, imps, unexported)
+	shared := &FileSet{
+		registry: gen.NewRegistry(),
+		diag:     &diagSink{w: lopts.Diagnostics, json: lopts.JSON},
+	}
+	fss := make([]*FileSet, len(pkgs))
+	roots := make(map[*FileSet]bool, len(pkgs))
+	for i, p := range pkgs {
+		fs, ok := imps[p.PkgPath]
+		if !ok {
+			fs = packageToFileSet(cfg.Fset, p, imps, shared, unexported)
+			imps[p.PkgPath] = fs
+		}
+		fss[i] = fs
+		roots[fs] = true
+	}
 	for _, ifs := range imps {
+		if roots[ifs] {
+			continue
+		}
 		ifs.process(warnPkgMask)
 		ifs.applyDirectives()
 		ifs.propInline()
 	}
-	fs.process(warnPkgMask)
-	fs.applyDirectives()
-	fs.propInline()
-	return fs, nil
+	for _, fs := range fss {
+		fs.process(warnPkgMask)
+		fs.applyDirectives()
+		fs.propInline()
+	}
+	return fss, nil
 }
 
-func packageToFileSet(p *packages.Package, imps map[string]*FileSet, unexported bool) *FileSet {
+// packageToFileSet returns the FileSet of p, whose
+// positions are in fset, and adds the FileSets of
+// its imports to imps. The FileSets share the
+// registry and diagnostic printing of shared.
+func packageToFileSet(fset *token.FileSet, p *packages.Package, imps map[string]*FileSet, shared *FileSet, unexported bool) *FileSet {
 	fs := &FileSet{
 		Package:    p.Name,
 		PkgPath:    p.PkgPath,
@@ -85,6 +182,14 @@ func packageToFileSet(p *packages.Package, imps map[string]*FileSet, unexported
 		Identities: make(map[string]gen.Elem),
 		ImportSet:  imps,
 		ImportName: make(map[string]string),
+		TypeParams: make(map[string]*ast.FieldList),
+		typesInfo:  p.TypesInfo,
+		fset:       fset,
+		registry:   shared.registry,
+		diag:       shared.diag,
+	}
+	if len(p.GoFiles) > 0 {
+		fs.Dir = filepath.Dir(p.GoFiles[0])
 	}
 
 	for name, importpkg := range p.Imports {
@@ -93,12 +198,14 @@ func packageToFileSet(p *packages.Package, imps map[string]*FileSet, unexported
 			continue
 		}
 
-		imps[name] = packageToFileSet(importpkg, imps, unexported)
+		imps[name] = packageToFileSet(fset, importpkg, imps, shared, unexported)
 	}
 
 	for _, fl := range p.Syntax {
-		pushstate(fl.Name.Name)
-		fs.Directives = append(fs.Directives, yieldComments(fl.Comments)...)
+		fs.pushstate(fl.Name.Name)
+		dirs, pos := yieldComments(fl.Comments)
+		fs.Directives = append(fs.Directives, dirs...)
+		fs.dirPositions = append(fs.dirPositions, pos...)
 		if !unexported {
 			ast.FileExports(fl)
 		}
@@ -115,7 +222,7 @@ func packageToFileSet(p *packages.Package, imps map[string]*FileSet, unexported
 			} else {
 				p, ok := imps[pkgpath]
 				if !ok {
-					fmt.Printf("missing import %s\n", pkgpath)
+					fs.warnf(importspec.Pos(), "missing import %s", pkgpath)
 				} else {
 					importname = p.Package
 				}
@@ -124,7 +231,7 @@ func packageToFileSet(p *packages.Package, imps map[string]*FileSet, unexported
 		}
 
 		fs.getTypeSpecs(fl)
-		popstate()
+		fs.popstate()
 	}
 
 	return fs
@@ -135,22 +242,36 @@ func packageToFileSet(p *packages.Package, imps map[string]*FileSet, unexported
 // directives remain in f.Directives
 func (f *FileSet) applyDirectives() {
 	newdirs := make([]string, 0, len(f.Directives))
-	for _, d := range f.Directives {
+	newpos := make([]token.Pos, 0, len(f.Directives))
+	for i, d := range f.Directives {
 		chunks := strings.Split(d, " ")
 		if len(chunks) > 0 {
 			if fn, ok := directives[chunks[0]]; ok {
-				pushstate(chunks[0])
+				f.pushstate(chunks[0])
+				f.dirPos = f.directivePos(i)
 				err := fn(chunks, f)
 				if err != nil {
-					warnln(err.Error())
+					f.warnf(f.dirPos, "%s", err)
 				}
-				popstate()
+				f.dirPos = token.NoPos
+				f.popstate()
 			} else {
 				newdirs = append(newdirs, d)
+				newpos = append(newpos, f.directivePos(i))
 			}
 		}
 	}
 	f.Directives = newdirs
+	f.dirPositions = newpos
+}
+
+// directivePos returns the position of f.Directives[i],
+// or token.NoPos if it is not known.
+func (f *FileSet) directivePos(i int) token.Pos {
+	if i < len(f.dirPositions) {
+		return f.dirPositions[i]
+	}
+	return token.NoPos
 }
 
 // A linkset is a graph of unresolved
@@ -190,6 +311,7 @@ func (f *FileSet) resolve(ls linkset) {
 				progress = true
 				nt := real.Copy()
 				nt.Alias(name)
+				nt.SetPos(elem.Pos())
 				f.Identities[name] = nt
 				delete(ls, name)
 			}
@@ -209,19 +331,35 @@ func (f *FileSet) resolve(ls linkset) {
 // uses them to populate f.Identities
 func (f *FileSet) process(warnPkgMask string) {
 	if warnPkgMask != "" && !strings.HasPrefix(f.PkgPath, warnPkgMask) {
-		increasePrintLevel()
-		defer decreasePrintLevel()
+		f.increasePrintLevel()
+		defer f.decreasePrintLevel()
 	}
 	deferred := make(linkset)
 parse:
 	for name, def := range f.Specs {
-		pushstate(name)
+		f.pushstate(name)
 
+		tp := f.TypeParams[name]
+		f.typeParams = f.typeParamPtrs(tp)
 		el := f.parseExpr("", def)
+		f.typeParams = nil
 
 		if el == nil {
-			warnln("failed to parse")
-			popstate()
+			f.warnf(def.Pos(), "failed to parse")
+			f.popstate()
+			continue parse
+		}
+		if tp != nil {
+			if be, ok := el.(*gen.BaseElem); ok && be.Value == gen.IDENT {
+				f.warnf(def.Pos(), "generic types defined as another named type are not supported")
+				f.popstate()
+				continue parse
+			}
+			decl, names := typeParamLists(tp)
+			el.Alias(name + names)
+			el.SetTypeParams(&gen.TypeParams{Decl: decl, Names: names})
+			f.Identities[name] = el
+			f.popstate()
 			continue parse
 		}
 		// push unresolved identities into
@@ -229,12 +367,12 @@ parse:
 		// we've handled every possible named type.
 		if be, ok := el.(*gen.BaseElem); ok && be.Value == gen.IDENT {
 			deferred[name] = be
-			popstate()
+			f.popstate()
 			continue parse
 		}
 		el.Alias(name)
 		f.Identities[name] = el
-		popstate()
+		f.popstate()
 	}
 
 	if len(deferred) > 0 {
@@ -242,6 +380,61 @@ parse:
 	}
 }
 
+// the import path of the msgp runtime, whose Msg
+// constrains the pointer type parameters
+const msgpPkgPath = "github.com/algorand/msgp/msgp"
+
+// typeParamPtrs maps every type parameter in tp to the
+// type parameter constrained by msgp.Msg of it, or to
+// "" if there isn't one.
+func (f *FileSet) typeParamPtrs(tp *ast.FieldList) map[string]string {
+	if tp == nil {
+		return nil
+	}
+	ptrs := make(map[string]string)
+	for _, field := range tp.List {
+		for _, nm := range field.Names {
+			if _, ok := ptrs[nm.Name]; !ok {
+				ptrs[nm.Name] = ""
+			}
+		}
+		// match msgp.Msg[T]
+		ix, ok := field.Type.(*ast.IndexExpr)
+		if !ok {
+			continue
+		}
+		sel, ok := ix.X.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "Msg" {
+			continue
+		}
+		pkg, ok := sel.X.(*ast.Ident)
+		if !ok || f.ImportName[pkg.Name] != msgpPkgPath {
+			continue
+		}
+		elem, ok := ix.Index.(*ast.Ident)
+		if !ok || len(field.Names) != 1 {
+			continue
+		}
+		ptrs[elem.Name] = field.Names[0].Name
+	}
+	return ptrs
+}
+
+// typeParamLists returns the declaration of the type
+// parameters in tp, and the list of their names.
+func typeParamLists(tp *ast.FieldList) (decl string, names string) {
+	var decls, nms []string
+	for _, field := range tp.List {
+		var fieldNames []string
+		for _, nm := range field.Names {
+			fieldNames = append(fieldNames, nm.Name)
+		}
+		decls = append(decls, strings.Join(fieldNames, ", ")+" "+types.ExprString(field.Type))
+		nms = append(nms, fieldNames...)
+	}
+	return "[" + strings.Join(decls, ", ") + "]", "[" + strings.Join(nms, ", ") + "]"
+}
+
 func strToMethod(s string) gen.Method {
 	switch s {
 	case "test":
@@ -254,6 +447,16 @@ func strToMethod(s string) gen.Method {
 		return gen.Unmarshal
 	case "maxsize":
 		return gen.MaxSize
+	case "copy":
+		return gen.Copy
+	case "equal":
+		return gen.Equal
+	case "randomize":
+		return gen.Randomize
+	case "fuzz":
+		return gen.Fuzz
+	case "golden":
+		return gen.Golden
 	default:
 		return 0
 	}
@@ -265,7 +468,8 @@ func (f *FileSet) applyDirs(p *gen.Printer) {
 	// 	//msgp:encode ignore {{TypeName}}
 	//
 loop:
-	for _, d := range f.Directives {
+	for i, d := range f.Directives {
+		pos := f.directivePos(i)
 		chunks := strings.Split(d, " ")
 		if len(chunks) > 1 {
 			for i := range chunks {
@@ -273,28 +477,33 @@ loop:
 			}
 			m := strToMethod(chunks[0])
 			if m == 0 {
-				warnf("unknown pass name: %q\n", chunks[0])
+				f.warnf(pos, "unknown pass name: %q", chunks[0])
 				continue loop
 			}
 			if fn, ok := passDirectives[chunks[1]]; ok {
-				pushstate(chunks[1])
-				err := fn(m, chunks[2:], p)
+				f.pushstate(chunks[1])
+				f.dirPos = pos
+				err := fn(m, chunks[2:], p, f)
 				if err != nil {
-					warnf("error applying directive: %s\n", err)
+					f.warnf(pos, "error applying directive: %s", err)
 				}
-				popstate()
+				f.dirPos = token.NoPos
+				f.popstate()
 			} else {
-				warnf("unrecognized directive %q\n", chunks[1])
+				f.warnf(pos, "unrecognized directive %q", chunks[1])
 			}
 		} else {
-			warnf("empty directive: %q\n", d)
+			f.warnf(pos, "empty directive: %q", d)
 		}
 	}
 }
 
+// PrintTo prints the methods of every identity in f with p.
+// The problems found by p are reported as error Diagnostics.
 func (f *FileSet) PrintTo(p *gen.Printer) error {
-	var msgs []string
+	var errs int
 
+	p.SetRegistry(f.registry)
 	f.applyDirs(p)
 	names := make([]string, 0, len(f.Identities))
 	for name := range f.Identities {
@@ -303,24 +512,108 @@ func (f *FileSet) PrintTo(p *gen.Printer) error {
 	sort.Strings(names)
 	for _, name := range names {
 		el := f.Identities[name]
-		el.SetVarname("z")
-		pushstate(el.TypeName())
+		f.pushstate(el.TypeName())
 		m, err := p.Print(el)
-		popstate()
 		if err != nil {
+			f.popstate()
 			return err
 		}
-		msgs = append(msgs, m...)
-	}
-	for _, msg := range msgs {
-		warnln(msg)
+		for _, d := range m {
+			pos := d.Pos
+			if !pos.IsValid() {
+				pos = el.Pos()
+			}
+			f.errorf(pos, "%s", d.Message)
+		}
+		errs += len(m)
+		f.popstate()
 	}
-	if len(msgs) > 0 {
+	if errs > 0 {
 		return fmt.Errorf("Errors encountered, exiting")
 	}
 	return nil
 }
 
+// declFile returns the file declaring the identity name,
+// or "" if it is not known.
+func (f *FileSet) declFile(name string) string {
+	pos := token.NoPos
+	if spec, ok := f.Specs[name]; ok {
+		pos = spec.Pos()
+	} else if el, ok := f.Identities[name]; ok {
+		pos = el.Pos()
+	}
+	if f.fset == nil || !pos.IsValid() {
+		return ""
+	}
+	return f.fset.Position(pos).Filename
+}
+
+// DeclFiles returns the sorted files declaring
+// the identities of f.
+func (f *FileSet) DeclFiles() []string {
+	seen := make(map[string]bool)
+	var files []string
+	for name := range f.Identities {
+		if file := f.declFile(name); file != "" && !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// DeclaredIn returns a copy of f whose identities are
+// only those declared in one of files, so that printing
+// it generates the methods of the types of these files.
+// The identities still refer to, and have inlined, the
+// types declared in the rest of the package.
+func (f *FileSet) DeclaredIn(files ...string) *FileSet {
+	in := make(map[string]bool, len(files))
+	for _, file := range files {
+		if abs, err := filepath.Abs(file); err == nil {
+			file = abs
+		}
+		in[file] = true
+	}
+	c := *f
+	c.Identities = make(map[string]gen.Elem)
+	c.Diagnostics = nil
+	c.logctx = nil
+	for name, el := range f.Identities {
+		if in[f.declFile(name)] {
+			c.Identities[name] = el
+		}
+	}
+	return &c
+}
+
+// Schema returns the wire schema of the identities in f.
+func (f *FileSet) Schema() *gen.Schema {
+	return gen.NewSchema(f.Package, f.Identities)
+}
+
+// Lint reports the findings of gen.Lint for
+// every identity in f as warnings, and returns
+// their number. No code is generated.
+func (f *FileSet) Lint() int {
+	names := make([]string, 0, len(f.Identities))
+	for name := range f.Identities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	els := make([]gen.Elem, len(names))
+	for i, name := range names {
+		els[i] = f.Identities[name]
+	}
+	msgs := gen.Lint(els, f.registry)
+	for _, d := range msgs {
+		f.warnf(d.Pos, "%s", d.Message)
+	}
+	return len(msgs)
+}
+
 // getTypeSpecs extracts all of the *ast.TypeSpecs in the file
 // into fs.Identities, but does not set the actual element
 func (fs *FileSet) getTypeSpecs(f *ast.File) {
@@ -357,6 +650,9 @@ func (fs *FileSet) getTypeSpecs(f *ast.File) {
 
 						if s.Assign == 0 {
 							fs.Specs[s.Name.Name] = s.Type
+							if s.TypeParams != nil {
+								fs.TypeParams[s.Name.Name] = s.TypeParams
+							}
 						} else {
 							fs.Aliases[s.Name.Name] = s.Type
 						}
@@ -391,14 +687,14 @@ func (fs *FileSet) parseFieldList(importPrefix string, fl *ast.FieldList) []gen.
 	}
 	out := make([]gen.StructField, 0, fl.NumFields())
 	for _, field := range fl.List {
-		pushstate(fieldName(field))
+		fs.pushstate(fieldName(field))
 		fds := fs.getField(importPrefix, field)
 		if len(fds) > 0 {
 			out = append(out, fds...)
 		} else {
-			warnln("ignored.")
+			fs.warnf(field.Pos(), "ignored.")
 		}
-		popstate()
+		fs.popstate()
 	}
 	return out
 }
@@ -410,6 +706,8 @@ func (fs *FileSet) getField(importPrefix string, f *ast.Field) []gen.StructField
 	var allocbound string
 	var allocbounds []string
 	var maxtotalbytes string
+	var since, until string
+	var aliases []string
 
 	// always flatten embedded structs
 	flatten = true
@@ -429,6 +727,15 @@ func (fs *FileSet) getField(importPrefix string, f *ast.Field) []gen.StructField
 			if strings.HasPrefix(tag, "maxtotalbytes=") {
 				maxtotalbytes = strings.Split(tag, "=")[1]
 			}
+			if strings.HasPrefix(tag, "since=") {
+				since = strings.Split(tag, "=")[1]
+			}
+			if strings.HasPrefix(tag, "until=") {
+				until = strings.Split(tag, "=")[1]
+			}
+			if strings.HasPrefix(tag, "alias=") {
+				aliases = append(aliases, strings.Split(tag, "=")[1])
+			}
 		}
 		// ignore "-" fields
 		if tags[0] == "-" {
@@ -438,11 +745,15 @@ func (fs *FileSet) getField(importPrefix string, f *ast.Field) []gen.StructField
 		sf[0].FieldTagParts = tags
 		sf[0].RawTag = f.Tag.Value
 	}
+	// each allocbound= part bounds a level of the field's type:
+	// a slice and then its elements, or a map, its keys and then
+	// its values, as in allocbound=8,allocbound=64 for a map[string]T
 	allocbound = strings.Join(allocbounds, ",")
 	ex := fs.parseExpr(importPrefix, f.Type)
 	if ex == nil {
 		return nil
 	}
+	ex.SetPos(f.Pos())
 
 	// parse field name
 	switch len(f.Names) {
@@ -470,10 +781,12 @@ func (fs *FileSet) getField(importPrefix string, f *ast.Field) []gen.StructField
 		// e.g. type A struct { One, Two int }
 		sf = sf[0:0]
 		for _, nm := range f.Names {
+			el := ex.Copy()
+			el.SetPos(nm.Pos())
 			sf = append(sf, gen.StructField{
 				FieldTag:  nm.Name,
 				FieldName: nm.Name,
-				FieldElem: ex.Copy(),
+				FieldElem: el,
 			})
 		}
 		return sf
@@ -504,6 +817,9 @@ func (fs *FileSet) getField(importPrefix string, f *ast.Field) []gen.StructField
 	}
 
 	sf[0].FieldElem = ex
+	sf[0].Since = since
+	sf[0].Until = until
+	sf[0].Aliases = aliases
 	if sf[0].FieldTag == "" {
 		sf[0].FieldTag = sf[0].FieldName
 	}
@@ -520,13 +836,13 @@ func (fs *FileSet) getField(importPrefix string, f *ast.Field) []gen.StructField
 			if b, ok := ex.Value.(*gen.BaseElem); ok {
 				b.Value = gen.Ext
 			} else {
-				warnln("couldn't cast to extension.")
+				fs.warnf(f.Pos(), "couldn't cast to extension.")
 				return nil
 			}
 		case *gen.BaseElem:
 			ex.Value = gen.Ext
 		default:
-			warnln("couldn't cast to extension.")
+			fs.warnf(f.Pos(), "couldn't cast to extension.")
 			return nil
 		}
 	}
@@ -588,6 +904,8 @@ func embedded(f ast.Expr) string {
 		return embedded(f.X)
 	case *ast.SelectorExpr:
 		return f.Sel.Name
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		return embedded(genericType(f))
 	default:
 		// other possibilities are disallowed
 		return ""
@@ -616,6 +934,18 @@ func stringify(e ast.Expr) string {
 	return "<BAD>"
 }
 
+// genericType returns the generic type of an instantiation.
+func genericType(e ast.Expr) ast.Expr {
+	switch e := e.(type) {
+	case *ast.IndexExpr:
+		return e.X
+	case *ast.IndexListExpr:
+		return e.X
+	default:
+		return e
+	}
+}
+
 // recursively translate ast.Expr to gen.Elem; nil means type not supported
 // expected input types:
 // - *ast.MapType (map[T]J)
@@ -625,7 +955,18 @@ func stringify(e ast.Expr) string {
 // - *ast.StructType (struct {})
 // - *ast.SelectorExpr (a.B)
 // - *ast.InterfaceType (interface {})
+// - *ast.IndexExpr, *ast.IndexListExpr (G[T], G[T, U])
+// parseExpr parses e into an Elem at the position of e,
+// or returns nil if the type of e is not supported.
 func (fs *FileSet) parseExpr(importPrefix string, e ast.Expr) gen.Elem {
+	el := fs.parseType(importPrefix, e)
+	if el != nil {
+		el.SetPos(e.Pos())
+	}
+	return el
+}
+
+func (fs *FileSet) parseType(importPrefix string, e ast.Expr) gen.Elem {
 	switch e := e.(type) {
 
 	case *ast.MapType:
@@ -642,7 +983,22 @@ func (fs *FileSet) parseExpr(importPrefix string, e ast.Expr) gen.Elem {
 		return &gen.Map{Key: kt, Value: vt}
 
 	case *ast.Ident:
+		if ptr, ok := fs.typeParams[e.Name]; ok {
+			if ptr == "" {
+				fs.warnf(e.Pos(), "type parameter %s needs a type parameter constrained by msgp.Msg[%s]", e.Name, e.Name)
+				return nil
+			}
+			b := gen.Ident("", e.Name)
+			b.TypeParamPtr = ptr
+			return b
+		}
+
 		b := gen.Ident(importPrefix, e.Name)
+		if b.Value == gen.IDENT {
+			if be := fs.builtinType(e); be != nil {
+				return be
+			}
+		}
 
 		// work to resove this expression
 		// can be done later, once we've resolved
@@ -652,7 +1008,7 @@ func (fs *FileSet) parseExpr(importPrefix string, e ast.Expr) gen.Elem {
 			_, aliasOK := fs.Aliases[e.Name]
 			_, interfaceOK := fs.Interfaces[e.Name]
 			if !specOK && !aliasOK && !interfaceOK {
-				warnf("non-local identifier: %s\n", e.Name)
+				fs.warnf(e.Pos(), "non-local identifier: %s", e.Name)
 			}
 		}
 		return b
@@ -664,6 +1020,9 @@ func (fs *FileSet) parseExpr(importPrefix string, e ast.Expr) gen.Elem {
 			if i, ok := e.Elt.(*ast.Ident); ok && i.Name == "byte" {
 				return &gen.BaseElem{Value: gen.Bytes}
 			}
+			if be := fs.builtinType(e.Elt); be != nil && be.Value == gen.Byte {
+				return &gen.BaseElem{Value: gen.Bytes}
+			}
 		}
 
 		// return early if we don't know
@@ -738,7 +1097,21 @@ func (fs *FileSet) parseExpr(importPrefix string, e ast.Expr) gen.Elem {
 		return &gen.Struct{Fields: fs.parseFieldList(importPrefix, e.Fields)}
 
 	case *ast.SelectorExpr:
-		return gen.Ident("", stringify(e))
+		b := gen.Ident("", stringify(e))
+		if b.Value == gen.IDENT {
+			if be := fs.builtinType(e); be != nil {
+				return be
+			}
+		}
+		return b
+
+	case *ast.IndexExpr, *ast.IndexListExpr:
+		// an instantiated generic type, e.g. Pair[A, B],
+		// whose methods are generated with the generic type
+		if _, ok := genericType(e).(*ast.SelectorExpr); ok {
+			importPrefix = ""
+		}
+		return gen.Ident(importPrefix, types.ExprString(e))
 
 	case *ast.InterfaceType:
 		// support `interface{}`
@@ -752,67 +1125,55 @@ func (fs *FileSet) parseExpr(importPrefix string, e ast.Expr) gen.Elem {
 	}
 }
 
-func infof(s string, v ...interface{}) {
-	pushstate(s)
-	if print(0) {
-		fmt.Printf(chalk.Green.Color(strings.Join(logctx, ": ")), v...)
-	}
-	popstate()
-}
-
-func infoln(s string) {
-	pushstate(s)
-	if print(0) {
-		fmt.Println(chalk.Green.Color(strings.Join(logctx, ": ")))
-	}
-	popstate()
-}
-
-func warnf(s string, v ...interface{}) {
-	pushstate(s)
-	if print(1) {
-		fmt.Printf(chalk.Yellow.Color(strings.Join(logctx, ": ")), v...)
+// builtinType resolves e with the type checker, and returns
+// the primitive for e if it is an alias of an empty interface
+// or of a basic type, such as any, or an alias of byte or rune.
+// Defined types are not resolved, since they may have methods.
+func (fs *FileSet) builtinType(e ast.Expr) *gen.BaseElem {
+	if fs.typesInfo == nil {
+		return nil
 	}
-	popstate()
-}
-
-func warnln(s string) {
-	pushstate(s)
-	if print(1) {
-		fmt.Println(chalk.Yellow.Color(strings.Join(logctx, ": ")))
+	t := fs.typesInfo.TypeOf(e)
+	if t == nil {
+		return nil
 	}
-	popstate()
-}
-
-func fatalf(s string, v ...interface{}) {
-	pushstate(s)
-	if print(2) {
-		fmt.Printf(chalk.Red.Color(strings.Join(logctx, ": ")), v...)
+	switch t := types.Unalias(t).(type) {
+	case *types.Interface:
+		if t.Empty() {
+			return &gen.BaseElem{Value: gen.Intf}
+		}
+	case *types.Basic:
+		// the byte and rune aliases keep their names,
+		// so the primitive follows the spelling aliased
+		if b := gen.Ident("", t.Name()); b.Value != gen.IDENT {
+			return b
+		}
 	}
-	popstate()
+	return nil
 }
 
-var logctx []string
-var printlevel int
-
-func increasePrintLevel() {
-	printlevel++
+// increasePrintLevel masks the diagnostics of f
+// of one more severity; see print.
+func (f *FileSet) increasePrintLevel() {
+	f.printlevel++
 }
 
-func decreasePrintLevel() {
-	printlevel--
+func (f *FileSet) decreasePrintLevel() {
+	f.printlevel--
 }
 
-func print(level int) bool {
-	return printlevel < level
+// print returns whether diagnostics of
+// the given level are reported for f.
+func (f *FileSet) print(level int) bool {
+	return f.printlevel < level
 }
 
 // push logging state
-func pushstate(s string) {
-	logctx = append(logctx, s)
+func (f *FileSet) pushstate(s string) {
+	f.logctx = append(f.logctx, s)
 }
 
 // pop logging state
-func popstate() {
-	logctx = logctx[:len(logctx)-1]
+func (f *FileSet) popstate() {
+	f.logctx = f.logctx[:len(f.logctx)-1]
 }
@@ -0,0 +1,98 @@
+package parse
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+
+	"github.com/algorand/msgp/gen"
+)
+
+func TestTypeParams(t *testing.T) {
+	src := `package p
+
+import "github.com/algorand/msgp/msgp"
+
+type Pair[K any, PK msgp.Msg[K], V, W any] struct{}
+`
+	f, err := parser.ParseFile(token.NewFileSet(), "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := f.Decls[1].(*ast.GenDecl).Specs[0].(*ast.TypeSpec).TypeParams
+
+	decl, names := typeParamLists(tp)
+	if decl != "[K any, PK msgp.Msg[K], V, W any]" {
+		t.Errorf("decl is %q", decl)
+	}
+	if names != "[K, PK, V, W]" {
+		t.Errorf("names are %q", names)
+	}
+
+	fs := FileSet{ImportName: map[string]string{"msgp": msgpPkgPath}}
+	ptrs := fs.typeParamPtrs(tp)
+	want := map[string]string{"K": "PK", "PK": "", "V": "", "W": ""}
+	if len(ptrs) != len(want) {
+		t.Fatalf("pointer type parameters are %v, expected %v", ptrs, want)
+	}
+	for k, v := range want {
+		if ptrs[k] != v {
+			t.Errorf("pointer type parameters are %v, expected %v", ptrs, want)
+		}
+	}
+}
+
+func TestBuiltinAliases(t *testing.T) {
+	src := `package p
+
+type Any = any
+type Empty = interface{}
+type B = byte
+type U = uint8
+type R = rune
+type Named interface{}
+
+type T struct {
+	A  any
+	B  Any
+	C  Empty
+	D  B
+	E  U
+	F  R
+	G  []B
+	H  map[string]any
+	I  Named
+	II int
+}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{Types: make(map[ast.Expr]types.TypeAndValue)}
+	if _, err := new(types.Config).Check("p", fset, []*ast.File{f}, info); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := FileSet{Interfaces: map[string]ast.Expr{"Named": nil}, typesInfo: info}
+	st := f.Decls[len(f.Decls)-1].(*ast.GenDecl).Specs[0].(*ast.TypeSpec).Type.(*ast.StructType)
+	want := []string{"Intf", "Intf", "Intf", "Byte", "Uint8", "Int32", "Bytes", "Map", "Ident", "Int"}
+	for i, fld := range st.Fields.List {
+		var kind string
+		switch el := fs.parseExpr("", fld.Type).(type) {
+		case *gen.BaseElem:
+			kind = el.Value.String()
+		case *gen.Map:
+			kind = "Map"
+			if v, ok := el.Value.(*gen.BaseElem); !ok || v.Value != gen.Intf {
+				t.Errorf("field %s: map value is %v, expected Intf", fld.Names[0], el.Value)
+			}
+		}
+		if kind != want[i] {
+			t.Errorf("field %s is %s, expected %s", fld.Names[0], kind, want[i])
+		}
+	}
+}
@@ -2,6 +2,7 @@ package parse
 
 import (
 	"sort"
+	"strings"
 
 	"github.com/algorand/msgp/gen"
 )
@@ -34,7 +35,7 @@ const maxComplex = 5
 // given name and replace them with be
 func (f *FileSet) findShim(id string, be *gen.BaseElem) {
 	for name, el := range f.Identities {
-		pushstate(name)
+		f.pushstate(name)
 		switch el := el.(type) {
 		case *gen.Struct:
 			for i := range el.Fields {
@@ -45,21 +46,30 @@ func (f *FileSet) findShim(id string, be *gen.BaseElem) {
 		case *gen.Slice:
 			f.nextShim(&el.Els, id, be)
 		case *gen.Map:
+			f.nextShim(&el.Key, id, be)
 			f.nextShim(&el.Value, id, be)
 		case *gen.Ptr:
 			f.nextShim(&el.Value, id, be)
 		}
-		popstate()
+		f.popstate()
+	}
+	// we'll need this at the top level as well,
+	// unless the type is declared in another
+	// package, where we can't add methods
+	if !strings.Contains(id, ".") {
+		if old, ok := f.Identities[id]; ok {
+			be.SetPos(old.Pos())
+		}
+		f.Identities[id] = be
 	}
-	// we'll need this at the top level as well
-	f.Identities[id] = be
 }
 
 func (f *FileSet) nextShim(ref *gen.Elem, id string, be *gen.BaseElem) {
 	if (*ref).TypeName() == id {
-		vn := (*ref).Varname()
+		vn, pos := (*ref).Varname(), (*ref).Pos()
 		*ref = be.Copy()
 		(*ref).SetVarname(vn)
+		(*ref).SetPos(pos)
 	} else {
 		switch el := (*ref).(type) {
 		case *gen.Struct:
@@ -71,6 +81,7 @@ func (f *FileSet) nextShim(ref *gen.Elem, id string, be *gen.BaseElem) {
 		case *gen.Slice:
 			f.nextShim(&el.Els, id, be)
 		case *gen.Map:
+			f.nextShim(&el.Key, id, be)
 			f.nextShim(&el.Value, id, be)
 		case *gen.Ptr:
 			f.nextShim(&el.Value, id, be)
@@ -102,7 +113,7 @@ func (f *FileSet) propInline() {
 
 	for i := range all {
 		name := all[i].name
-		pushstate(name)
+		f.pushstate(name)
 		switch el := all[i].el.(type) {
 		case *gen.Struct:
 			for i := range el.Fields {
@@ -113,11 +124,12 @@ func (f *FileSet) propInline() {
 		case *gen.Slice:
 			f.nextInline(&el.Els, name)
 		case *gen.Map:
+			f.nextInline(&el.Key, name)
 			f.nextInline(&el.Value, name)
 		case *gen.Ptr:
 			f.nextInline(&el.Value, name)
 		}
-		popstate()
+		f.popstate()
 	}
 }
 
@@ -132,7 +144,7 @@ func (f *FileSet) nextInline(ref *gen.Elem, root string) {
 		// ensure that we're not inlining
 		// a type into itself
 		typ := el.TypeName()
-		if el.Value == gen.IDENT && typ != root {
+		if el.Value == gen.IDENT && el.TypeParamPtr == "" && typ != root {
 			if node, ok := f.Identities[typ]; ok && node.Complexity() < maxComplex {
 				// infof("inlining %s\n", typ)
 
@@ -142,7 +154,9 @@ func (f *FileSet) nextInline(ref *gen.Elem, root string) {
 					panic(fatalloop)
 				}
 
+				pos := (*ref).Pos()
 				*ref = node.Copy()
+				(*ref).SetPos(pos)
 				f.nextInline(ref, node.TypeName())
 			} else if !ok && !el.Resolved() {
 				// this is the point at which we're sure that
@@ -166,6 +180,7 @@ func (f *FileSet) nextInline(ref *gen.Elem, root string) {
 	case *gen.Slice:
 		f.nextInline(&el.Els, root)
 	case *gen.Map:
+		f.nextInline(&el.Key, root)
 		f.nextInline(&el.Value, root)
 	case *gen.Ptr:
 		f.nextInline(&el.Value, root)
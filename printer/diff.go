@@ -0,0 +1,197 @@
+package printer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the number of unchanged lines around the changes of a hunk
+const diffContext = 3
+
+// the most edits searched for by myers; larger differences
+// are shown as removing and adding every line
+const maxDiffEdits = 2000
+
+// a line of a diff: kept (' '), removed ('-') or added ('+')
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// unifiedDiff returns the unified diff from old, the content of
+// file a, to new, the content of file b, or "" if they are equal.
+func unifiedDiff(a, b string, old, new []byte) string {
+	if string(old) == string(new) {
+		return ""
+	}
+	ops := lineOps(splitLines(string(old)), splitLines(string(new)))
+
+	// the old and new line numbers before each op
+	oldNo := make([]int, len(ops)+1)
+	newNo := make([]int, len(ops)+1)
+	var changes []int
+	for k, op := range ops {
+		oldNo[k+1], newNo[k+1] = oldNo[k], newNo[k]
+		if op.kind != '+' {
+			oldNo[k+1]++
+		}
+		if op.kind != '-' {
+			newNo[k+1]++
+		}
+		if op.kind != ' ' {
+			changes = append(changes, k)
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", a, b)
+	for i := 0; i < len(changes); {
+		start := changes[i] - diffContext
+		end := changes[i] + 1 + diffContext
+		j := i + 1
+		for j < len(changes) && changes[j]-diffContext <= end {
+			end = changes[j] + 1 + diffContext
+			j++
+		}
+		if start < 0 {
+			start = 0
+		}
+		if end > len(ops) {
+			end = len(ops)
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n",
+			hunkRange(oldNo[start], oldNo[end]-oldNo[start]),
+			hunkRange(newNo[start], newNo[end]-newNo[start]))
+		for _, op := range ops[start:end] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = j
+	}
+	return sb.String()
+}
+
+// hunkRange returns the range of n lines after line
+// before of a hunk header, as "line,count".
+func hunkRange(before, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	return fmt.Sprintf("%d,%d", before+1, n)
+}
+
+// splitLines splits s after every newline.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineOps returns the edits from x to y, keeping a longest
+// common subsequence of the lines between their common
+// prefix and suffix.
+func lineOps(x, y []string) []diffOp {
+	p := 0
+	for p < len(x) && p < len(y) && x[p] == y[p] {
+		p++
+	}
+	s := 0
+	for s < len(x)-p && s < len(y)-p && x[len(x)-1-s] == y[len(y)-1-s] {
+		s++
+	}
+	ops := make([]diffOp, 0, len(x)+len(y))
+	for _, l := range x[:p] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	ops = append(ops, myers(x[p:len(x)-s], y[p:len(y)-s])...)
+	for _, l := range x[len(x)-s:] {
+		ops = append(ops, diffOp{' ', l})
+	}
+	return ops
+}
+
+// myers returns the shortest edits from x to y, found by
+// Myers' O((N+M)D) algorithm, or if they are more than
+// maxDiffEdits, the edits removing x and adding y.
+func myers(x, y []string) []diffOp {
+	n, m := len(x), len(y)
+	max := n + m
+	if max > maxDiffEdits {
+		max = maxDiffEdits
+	}
+	// v[off+k] is the furthest x reached on diagonal k = x-y,
+	// and trace[d] holds v[off-d:off+d+1] after d edits
+	off := max + 1
+	v := make([]int, 2*off+1)
+	var trace [][]int
+	found := false
+	for d := 0; d <= max && !found; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x0 int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x0 = v[off+k+1]
+			} else {
+				x0 = v[off+k-1] + 1
+			}
+			y0 := x0 - k
+			for x0 < n && y0 < m && x[x0] == y[y0] {
+				x0, y0 = x0+1, y0+1
+			}
+			v[off+k] = x0
+			if x0 >= n && y0 >= m {
+				found = true
+			}
+		}
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+	}
+	if !found {
+		ops := make([]diffOp, 0, n+m)
+		for _, l := range x {
+			ops = append(ops, diffOp{'-', l})
+		}
+		for _, l := range y {
+			ops = append(ops, diffOp{'+', l})
+		}
+		return ops
+	}
+
+	// walk the edits back from the end
+	var rev []diffOp
+	x0, y0 := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		at := func(k int) int { return prev[k+d-1] }
+		k := x0 - y0
+		pk := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			pk = k + 1
+		}
+		px := at(pk)
+		py := px - pk
+		for x0 > px && y0 > py {
+			x0, y0 = x0-1, y0-1
+			rev = append(rev, diffOp{' ', x[x0]})
+		}
+		if pk == k+1 {
+			y0--
+			rev = append(rev, diffOp{'+', y[y0]})
+		} else {
+			x0--
+			rev = append(rev, diffOp{'-', x[x0]})
+		}
+	}
+	for x0 > 0 {
+		x0--
+		rev = append(rev, diffOp{' ', x[x0]})
+	}
+	ops := make([]diffOp, len(rev))
+	for i, op := range rev {
+		ops[len(rev)-1-i] = op
+	}
+	return ops
+}
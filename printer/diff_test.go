@@ -0,0 +1,92 @@
+package printer
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	new := "a\nb\nc\nd\nE\nf\ng\nh\ni\nj\nk\n"
+	want := `--- x_gen.go
++++ x_gen.go
+@@ -2,9 +2,10 @@
+ b
+ c
+ d
+-e
++E
+ f
+ g
+ h
+ i
+ j
++k
+`
+	if got := unifiedDiff("x_gen.go", "x_gen.go", []byte(old), []byte(new)); got != want {
+		t.Errorf("got diff\n%s\nexpected\n%s", got, want)
+	}
+	if got := unifiedDiff("x_gen.go", "x_gen.go", []byte(old), []byte(old)); got != "" {
+		t.Errorf("got diff of equal files\n%s", got)
+	}
+	if got := unifiedDiff("x_gen.go", "x_gen.go", nil, []byte("a\n")); got != "--- x_gen.go\n+++ x_gen.go\n@@ -0,0 +1,1 @@\n+a\n" {
+		t.Errorf("got diff from an empty file\n%s", got)
+	}
+}
+
+func TestLineOps(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	lines := func() []string {
+		l := make([]string, r.Intn(40))
+		for i := range l {
+			l[i] = string(rune('a'+r.Intn(4))) + "\n"
+		}
+		return l
+	}
+	for i := 0; i < 1000; i++ {
+		x, y := lines(), lines()
+		var gotx, goty []string
+		for _, op := range lineOps(x, y) {
+			if op.kind != '+' {
+				gotx = append(gotx, op.line)
+			}
+			if op.kind != '-' {
+				goty = append(goty, op.line)
+			}
+		}
+		if strings.Join(gotx, "") != strings.Join(x, "") || strings.Join(goty, "") != strings.Join(y, "") {
+			t.Fatalf("edits from %q to %q do not reproduce them", x, y)
+		}
+	}
+}
+
+func TestObsolete(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "x_gen.go")
+	for _, name := range []string{file, filepath.Join(dir, "x_gen_test.go")} {
+		if err := os.WriteFile(name, []byte("package x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// without tests, the test file is obsolete
+	obsolete := Obsolete(file, []Rendered{{File: file, Data: []byte("package x\n")}})
+	if len(obsolete) != 1 || obsolete[0].File != filepath.Join(dir, "x_gen_test.go") {
+		t.Fatalf("obsolete files %v, expected x_gen_test.go", obsolete)
+	}
+	// without types, both are
+	obsolete = Obsolete(file, nil)
+	if len(obsolete) != 2 {
+		t.Fatalf("obsolete files %v, expected x_gen.go and x_gen_test.go", obsolete)
+	}
+	diff, err := DiffFiles(obsolete)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, "@@ -1,1 +0,0 @@\n-package x\n") {
+		t.Errorf("the diff does not remove the obsolete files:\n%s", diff)
+	}
+}
@@ -0,0 +1,111 @@
+package printer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/daixiang0/gci/pkg/constants"
+	"github.com/daixiang0/gci/pkg/gci"
+	importPkg "github.com/daixiang0/gci/pkg/gci/imports"
+	sectionsPkg "github.com/daixiang0/gci/pkg/gci/sections"
+	"github.com/daixiang0/gci/pkg/gci/specificity"
+)
+
+// groupImports arranges the import block of data, as printed
+// by goimports, into the sections of cfg. It does what
+// gci.LoadFormatGoFile does, but without gci's logging to the
+// standard logger, which a library must leave to its caller.
+// Like gci, it leaves a block that it cannot parse alone.
+func groupImports(data []byte, cfg *gci.GciConfiguration) ([]byte, error) {
+	start := bytes.Index(data, []byte(constants.ImportStartFlag))
+	if start < 0 {
+		return data, nil
+	}
+	start += len(constants.ImportStartFlag)
+	end := bytes.Index(data[start:], []byte(constants.ImportEndFlag))
+	if end < 0 {
+		return data, nil
+	}
+	end += start
+
+	imports, ok := parseImports(string(data[start:end]))
+	if !ok {
+		return data, nil
+	}
+
+	// match every import to its most specific section
+	sectionMap := make(map[sectionsPkg.Section][]importPkg.ImportDef, len(cfg.Sections))
+	for _, i := range imports {
+		var best sectionsPkg.Section
+		var bestSpecificity specificity.MatchSpecificity = specificity.MisMatch{}
+		for _, section := range cfg.Sections {
+			s := section.MatchSpecificity(i)
+			if s.IsMoreSpecific(specificity.MisMatch{}) && s.Equal(bestSpecificity) {
+				return nil, fmt.Errorf("import %s matched sections %s and %s equally", i, best, section)
+			}
+			if s.IsMoreSpecific(bestSpecificity) {
+				best, bestSpecificity = section, s
+			}
+		}
+		if best == nil {
+			return nil, fmt.Errorf("no import section for %s", i)
+		}
+		sectionMap[best] = append(sectionMap[best], i)
+	}
+
+	var sections []string
+	for _, section := range cfg.Sections {
+		// an empty section would add a separator
+		if s := section.Format(sectionMap[section], cfg.FormatterConfiguration); s != "" {
+			sections = append(sections, s)
+		}
+	}
+	var separator string
+	for _, sep := range cfg.SectionSeparators {
+		separator += sep.Format(nil, cfg.FormatterConfiguration)
+	}
+
+	var out []byte
+	out = append(out, data[:start]...)
+	out = append(out, strings.Join(sections, separator)...)
+	out = append(out, data[end+1:]...)
+	return out, nil
+}
+
+// parseImports parses the lines of an import block, one
+// import per line, with its comments. It reports false for
+// the block comments and other lines that it cannot parse.
+func parseImports(block string) ([]importPkg.ImportDef, bool) {
+	var imports []importPkg.ImportDef
+	var def importPkg.ImportDef
+	for _, line := range strings.Split(block, constants.Linebreak) {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, constants.LineCommentFlag):
+			def.PrefixComment = append(def.PrefixComment, line)
+			continue
+		case strings.Contains(line, constants.BlockCommentStartFlag):
+			return nil, false
+		}
+		if i := strings.Index(line, constants.LineCommentFlag); i >= 0 {
+			line, def.InlineComment = strings.TrimSpace(line[:i]), line[i:]
+		}
+		switch fields := strings.Fields(line); len(fields) {
+		case 1:
+			def.QuotedPath = fields[0]
+		case 2:
+			def.Alias, def.QuotedPath = fields[0], fields[1]
+		default:
+			return nil, false
+		}
+		if def.Validate() != nil {
+			return nil, false
+		}
+		imports = append(imports, def)
+		def = importPkg.ImportDef{}
+	}
+	return imports, true
+}
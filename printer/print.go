@@ -5,12 +5,13 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"strings"
+	"text/template"
 
 	"github.com/algorand/msgp/gen"
 	"github.com/algorand/msgp/parse"
 	"github.com/daixiang0/gci/pkg/gci"
-	"github.com/daixiang0/gci/pkg/gci/sections"
 	"github.com/ttacon/chalk"
 	"golang.org/x/tools/imports"
 )
@@ -19,14 +20,141 @@ func infof(s string, v ...interface{}) {
 	fmt.Printf(chalk.Magenta.Color(s), v...)
 }
 
+// TestOptions customizes the generated test file.
+type TestOptions struct {
+	// Template replaces the built-in tests, if non-nil.
+	// See gen.ParseTestTemplate.
+	Template *template.Template
+
+	// Imports are imported by the test file in addition
+	// to the imports of the built-in tests. An import
+	// may be aliased, as in `name "path"`.
+	Imports []string
+
+	// Tags are the build tags that the test file
+	// requires, e.g. "!skip_msgp_testing".
+	Tags []string
+}
+
+// DefaultTestOptions produces the built-in tests, which are
+// left out of builds with the skip_msgp_testing tag.
+var DefaultTestOptions = TestOptions{
+	Tags: []string{"!skip_msgp_testing"},
+}
+
+// FormatOptions controls how the generated files are formatted.
+type FormatOptions struct {
+	// Skip writes the generated code unformatted (for debug).
+	Skip bool
+
+	// ImportSections are the gci sections, such as "standard",
+	// "default" or "prefix(github.com/algorand)", that imports
+	// are grouped into. If empty, imports are grouped the way
+	// goimports groups them.
+	ImportSections []string
+
+	// Tags are the build tags that the generated files require,
+	// such as the tag set they were generated for. The test
+	// file requires them in addition to TestOptions.Tags.
+	Tags []string
+}
+
+// DefaultFormatOptions groups the imports of go-algorand
+// after the standard library and other modules.
+var DefaultFormatOptions = FormatOptions{
+	ImportSections: []string{
+		"standard",
+		"default",
+		"prefix(github.com/algorand)",
+		"prefix(github.com/algorand/go-algorand)",
+	},
+}
+
 // PrintFile prints the methods for the provided list
 // of elements to the given file name and canonical
 // package path.
-func PrintFile(file string, f *parse.FileSet, mode gen.Method, skipFormat bool) error {
-	out, tests, err := generate(f, mode)
+func PrintFile(file string, f *parse.FileSet, mode gen.Method, fopts FormatOptions, topts TestOptions) error {
+	files, _, err := Render(file, f, mode, fopts, topts, nil)
 	if err != nil {
 		return err
 	}
+	for _, r := range files {
+		if err := ioutil.WriteFile(r.File, r.Data, 0600); err != nil {
+			return err
+		}
+		infof(">>> Wrote and formatted \"%s\"\n", r.File)
+	}
+	return nil
+}
+
+// Diff prints the methods like PrintFile, but instead of writing
+// the files, it returns the unified diff from their current
+// content to the printed one, or "" if they are up to date.
+func Diff(file string, f *parse.FileSet, mode gen.Method, fopts FormatOptions, topts TestOptions) (string, error) {
+	files, _, err := Render(file, f, mode, fopts, topts, nil)
+	if err != nil {
+		return "", err
+	}
+	return DiffFiles(files)
+}
+
+// DiffFiles returns the unified diff from the current
+// content of the files to their rendered one, or "" if
+// they are up to date.
+func DiffFiles(files []Rendered) (string, error) {
+	var diff strings.Builder
+	for _, r := range files {
+		old, err := ioutil.ReadFile(r.File)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		diff.WriteString(unifiedDiff(r.File, r.File, old, r.Data))
+	}
+	return diff.String(), nil
+}
+
+// Obsolete returns the existing generated file and test file
+// of file that are not among files, which Render would no longer
+// write, as Rendered with no Data, so that DiffFiles shows their
+// removal.
+func Obsolete(file string, files []Rendered) []Rendered {
+	var obsolete []Rendered
+	for _, name := range []string{file, strings.TrimSuffix(file, ".go") + "_test.go"} {
+		rendered := false
+		for _, r := range files {
+			rendered = rendered || r.File == name
+		}
+		if _, err := os.Stat(name); err == nil && !rendered {
+			obsolete = append(obsolete, Rendered{File: name})
+		}
+	}
+	return obsolete
+}
+
+// A Rendered is a printed and formatted file.
+type Rendered struct {
+	File string
+	Data []byte
+}
+
+// Render prints and formats the methods of f for file, and the
+// tests for its _test.go file, if mode generates any, in memory.
+// The code generated by plugins follows the methods of each type.
+// It also returns the Topics, the methods printed for each type.
+func Render(file string, f *parse.FileSet, mode gen.Method, fopts FormatOptions, topts TestOptions, plugins []gen.Plugin) ([]Rendered, *gen.Topics, error) {
+	var gciCfg *gci.GciConfiguration
+	if len(fopts.ImportSections) > 0 {
+		var err error
+		gciCfg, err = gci.GciStringConfiguration{SectionStrings: fopts.ImportSections}.Parse()
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid import sections %q: %v", fopts.ImportSections, err)
+		}
+	}
+
+	out, tests, topics, err := generate(f, mode, fopts.Tags, topts, plugins)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// we'll run goimports on the main file
 	// in another goroutine, and run it here
@@ -34,54 +162,51 @@ func PrintFile(file string, f *parse.FileSet, mode gen.Method, skipFormat bool)
 	// takes about the same amount of time as
 	// doing them in serial when GOMAXPROCS=1,
 	// and faster otherwise.
-	res := goformat(file, out.Bytes(), skipFormat)
+	var data []byte
+	res := goformat(file, out.Bytes(), fopts.Skip, gciCfg, &data)
+	var testfile Rendered
 	if tests != nil {
-		testfile := strings.TrimSuffix(file, ".go") + "_test.go"
-		err = format(testfile, tests.Bytes(), skipFormat)
+		testfile.File = strings.TrimSuffix(file, ".go") + "_test.go"
+		testfile.Data, err = format(testfile.File, tests.Bytes(), fopts.Skip, gciCfg)
 		if err != nil {
-			return err
+			<-res
+			return nil, nil, err
 		}
-		infof(">>> Wrote and formatted \"%s\"\n", testfile)
 	}
-	err = <-res
-	if err != nil {
-		return err
+	if err := <-res; err != nil {
+		return nil, nil, err
 	}
-	return nil
+	files := []Rendered{{File: file, Data: data}}
+	if tests != nil {
+		files = append(files, testfile)
+	}
+	return files, topics, nil
 }
 
-func format(file string, data []byte, skipFormat bool) error {
+// format returns data, the content of file, formatted
+// by goimports and, if gciCfg is non-nil, by gci.
+func format(file string, data []byte, skipFormat bool, gciCfg *gci.GciConfiguration) ([]byte, error) {
 	if skipFormat {
-		return ioutil.WriteFile(file, data, 0600)
+		return data, nil
 	}
 	// first run through goimports (which cleans up unused deps & does gofmt)
 	out, err := imports.Process(file, data, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if err := ioutil.WriteFile(file, out, 0600); err != nil {
-		return err
-	}
-	// then run through gci to arrange import order
-	if err := gci.WriteFormattedFiles([]string{file}, gci.GciConfiguration{
-		Sections: gci.SectionList{
-			sections.StandardPackage{},
-			sections.DefaultSection{},
-			sections.Prefix{ImportPrefix: "github.com/algorand"},
-			sections.Prefix{ImportPrefix: "github.com/algorand/go-algorand"},
-		},
-		SectionSeparators: gci.SectionList{sections.NewLine{}},
-	}); err != nil {
-		return err
+	if gciCfg == nil {
+		return out, nil
 	}
-	return nil
+	// then arrange the imports into the gci sections
+	return groupImports(out, gciCfg)
 }
 
-func goformat(file string, data []byte, skipFormat bool) <-chan error {
+func goformat(file string, data []byte, skipFormat bool, gciCfg *gci.GciConfiguration, formatted *[]byte) <-chan error {
 	out := make(chan error, 1)
 	go func(file string, data []byte, end chan error) {
-		end <- format(file, data, skipFormat)
-		infof(">>> Wrote and formatted \"%s\"\n", file)
+		var err error
+		*formatted, err = format(file, data, skipFormat, gciCfg)
+		end <- err
 	}(file, data, out)
 	return out
 }
@@ -98,11 +223,19 @@ func dedupImports(imp []string) []string {
 	return r
 }
 
-func generate(f *parse.FileSet, mode gen.Method) (*bytes.Buffer, *bytes.Buffer, error) {
+func generate(f *parse.FileSet, mode gen.Method, tags []string, topts TestOptions, plugins []gen.Plugin) (*bytes.Buffer, *bytes.Buffer, *gen.Topics, error) {
 	outbuf := bytes.NewBuffer(make([]byte, 0, 4096))
+	if len(tags) > 0 {
+		writeBuildHeader(outbuf, tags)
+	}
 	writePkgHeader(outbuf, f.Package)
 
 	myImports := []string{"github.com/algorand/msgp/msgp"}
+	if mode&gen.Randomize != 0 {
+		// spell out math/rand, which goimports could
+		// confuse with math/rand/v2 for RandomizeMsg
+		myImports = append(myImports, "math/rand")
+	}
 	for _, imp := range f.Imports {
 		if imp.Name != nil {
 			// have an alias, include it.
@@ -116,27 +249,39 @@ func generate(f *parse.FileSet, mode gen.Method) (*bytes.Buffer, *bytes.Buffer,
 
 	var testbuf *bytes.Buffer
 	var testwr io.Writer
-	if mode&gen.Test == gen.Test {
+	if mode&(gen.Test|gen.Fuzz|gen.Golden) != 0 {
 		testbuf = bytes.NewBuffer(make([]byte, 0, 4096))
-		writeBuildHeader(testbuf, []string{"!skip_msgp_testing"})
+		if testTags := append(append([]string(nil), topts.Tags...), tags...); len(testTags) > 0 {
+			writeBuildHeader(testbuf, testTags)
+		}
 		writePkgHeader(testbuf, f.Package)
-		writeImportHeader(
-			testbuf,
+		testImports := []string{
+			"bytes",
+			"math/rand",
+			"os",
+			"path/filepath",
+			"testing",
 			"github.com/algorand/msgp/msgp",
-			"github.com/algorand/go-algorand/protocol",
-			"github.com/algorand/go-algorand/test/partitiontest",
-			"testing")
+		}
+		writeImportHeader(testbuf, dedupImports(append(testImports, topts.Imports...))...)
 		testwr = testbuf
 	}
 	funcbuf := bytes.NewBuffer(make([]byte, 0, 4096))
-	var topics gen.Topics
+	topics := new(gen.Topics)
 
-	err := f.PrintTo(gen.NewPrinter(mode, &topics, funcbuf, testwr))
+	p := gen.NewPrinter(mode, topics, funcbuf, testwr)
+	if topts.Template != nil {
+		p.SetTestTemplate(topts.Template)
+	}
+	for _, pl := range plugins {
+		p.AddPlugin(pl)
+	}
+	err := f.PrintTo(p)
 	if err == nil {
 		outbuf.Write(topics.Bytes())
 		outbuf.Write(funcbuf.Bytes())
 	}
-	return outbuf, testbuf, err
+	return outbuf, testbuf, topics, err
 }
 
 func writePkgHeader(b *bytes.Buffer, name string) {
@@ -162,7 +307,10 @@ func writeImportHeader(b *bytes.Buffer, imports ...string) {
 	b.WriteString(")\n\n")
 }
 
+// writeBuildHeader requires all of the build tags. In
+// a +build line, commas join the tags (AND), and spaces
+// join alternatives (OR).
 func writeBuildHeader(b *bytes.Buffer, buildHeaders []string) {
-	headers := fmt.Sprintf("//go:build %s\n// +build %s\n\n", strings.Join(buildHeaders, " "), strings.Join(buildHeaders, " "))
+	headers := fmt.Sprintf("//go:build %s\n// +build %s\n\n", strings.Join(buildHeaders, " && "), strings.Join(buildHeaders, ","))
 	b.WriteString(headers)
 }
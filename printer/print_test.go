@@ -2,7 +2,15 @@ package printer
 
 import (
 	"bytes"
+	"context"
+	"go/build/constraint"
+	"log"
+	"os"
+	"strings"
 	"testing"
+
+	"github.com/algorand/msgp/gen"
+	"github.com/algorand/msgp/parse"
 )
 
 func TestWriteBuildHeader(t *testing.T) {
@@ -17,3 +25,64 @@ func TestWriteBuildHeader(t *testing.T) {
 		t.Errorf("testBuf:\n%s not equal to expectedBuf:\n%s", testBuf, expectedBuf)
 	}
 }
+
+func TestWriteBuildHeaderMultipleTags(t *testing.T) {
+	testBuf := bytes.NewBuffer(make([]byte, 0, 4096))
+	writeBuildHeader(testBuf, []string{"!skip_msgp_testing", "linux"})
+
+	expected := "//go:build !skip_msgp_testing && linux\n// +build !skip_msgp_testing,linux\n\n"
+	if testBuf.String() != expected {
+		t.Errorf("testBuf:\n%s not equal to expected:\n%s", testBuf, expected)
+	}
+
+	// both lines require both tags
+	var exprs []constraint.Expr
+	for _, line := range strings.Split(strings.TrimSpace(testBuf.String()), "\n") {
+		x, err := constraint.Parse(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exprs = append(exprs, x)
+	}
+	for _, tags := range []map[string]bool{{}, {"linux": true}, {"skip_msgp_testing": true, "linux": true}} {
+		want := !tags["skip_msgp_testing"] && tags["linux"]
+		for _, x := range exprs {
+			if got := x.Eval(func(tag string) bool { return tags[tag] }); got != want {
+				t.Errorf("%s is %v with the tags %v", x, got, tags)
+			}
+		}
+	}
+}
+
+func TestRenderImportSections(t *testing.T) {
+	fss, err := parse.Packages(context.Background(), []string{"../testdata/pkgs/b"}, true, "", parse.LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fopts := FormatOptions{ImportSections: []string{"prefix(github.com/algorand/msgp)", "standard"}}
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	files, _, err := Render("b_gen.go", fss[0], gen.Marshal|gen.Unmarshal|gen.Test, fopts, TestOptions{}, nil)
+	log.SetOutput(os.Stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logged.Len() > 0 {
+		t.Errorf("rendering logged %q", logged.String())
+	}
+
+	// the sections are in the given order, unlike
+	// the standard library first in goimports
+	want := "import (\n\t\"github.com/algorand/msgp/msgp\"\n\n\t\"bytes\"\n"
+	if src := string(files[1].Data); !strings.Contains(src, want) {
+		t.Errorf("the imports of %s are not grouped as\n%s\n%s", files[1].File, want, src)
+	}
+}
+
+func TestRenderInvalidImportSections(t *testing.T) {
+	fopts := FormatOptions{ImportSections: []string{"standard", "nosuchsection"}}
+	_, _, err := Render("x_gen.go", nil, gen.Marshal, fopts, TestOptions{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid import sections") {
+		t.Errorf("rendering with the import sections %q: %v", fopts.ImportSections, err)
+	}
+}
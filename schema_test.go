@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/algorand/msgp/gen"
+	"github.com/algorand/msgp/parse"
+)
+
+func TestSchema(t *testing.T) {
+	fs, err := parse.File("testdata/schema.go", true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := fs.Schema()
+
+	pt := s.Types["Point"]
+	if pt == nil || pt.Kind != gen.KindTuple || len(pt.Fields) != 2 || pt.Fields[0].Tag != "y" {
+		t.Errorf("Point is not a tuple of Y, X: %+v", pt)
+	}
+
+	rec := s.Types["Record"]
+	if rec == nil || rec.Kind != gen.KindStruct {
+		t.Fatalf("Record is not a struct: %+v", rec)
+	}
+	fields := make(map[string]gen.Field)
+	var tags []string
+	for _, f := range rec.Fields {
+		fields[f.Tag] = f
+		tags = append(tags, f.Tag)
+	}
+	if want := []string{"e", "m", "n", "o", "p", "t"}; len(tags) != len(want) {
+		t.Errorf("tags are %v, expected %v", tags, want)
+	} else {
+		for i := range want {
+			if tags[i] != want[i] {
+				t.Errorf("tags are %v, expected %v", tags, want)
+				break
+			}
+		}
+	}
+	if f := fields["n"]; f.Shape.Primitive != "string" || f.Shape.AllocBound != "64" || !f.OmitEmpty {
+		t.Errorf("field n is %+v %+v", f, f.Shape)
+	}
+	if f := fields["t"]; f.Shape.Kind != gen.KindSlice || f.Shape.AllocBound != "8" || f.Shape.Elem.AllocBound != "32" {
+		t.Errorf("field t is %+v", f.Shape)
+	}
+	if f := fields["m"]; f.Shape.Shim == nil || f.Shape.Primitive != "string" || f.Shape.Shim.ToBase != "monthToString" {
+		t.Errorf("field m is %+v", f.Shape)
+	}
+	if f := fields["e"]; f.Shape.Kind != gen.KindPtr || f.Shape.Elem.Kind != gen.KindExt {
+		t.Errorf("field e is %+v", f.Shape)
+	}
+	if f := fields["o"]; f.Since != "2" {
+		t.Errorf("field o is %+v", f)
+	}
+
+	a, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(fs.Schema())
+	if string(a) != string(b) {
+		t.Errorf("schema is not stable:\n%s\n%s", a, b)
+	}
+}
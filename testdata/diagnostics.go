@@ -0,0 +1,16 @@
+package diagnostics
+
+type Diag struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	Fn    func()   `codec:"f"`
+	Names []string `codec:"n"`
+}
+
+//msgp:shim Enum as:string using:(Enum).String/enumStr
+
+type Enum uint8
+
+func (e Enum) String() string { return "" }
+
+func enumStr(s string) Enum { return 0 }
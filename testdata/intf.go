@@ -0,0 +1,15 @@
+package testdata
+
+// Empty is resolved by the type checker.
+type Empty = interface{}
+
+// Intf has fields of interface types,
+// which have no MessagePack encoding.
+type Intf struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	N uint64         `codec:"n"`
+	V any            `codec:"v"`
+	E Empty          `codec:"e"`
+	M map[string]any `codec:"m,allocbound=4"`
+}
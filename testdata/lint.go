@@ -0,0 +1,28 @@
+package lint
+
+import "time"
+
+type Key struct{ A int }
+
+type Linted struct {
+	_struct struct{}       `codec:",omitempty,omitemptyarray"`
+	F       float64        `codec:"f"`
+	When    time.Time      `codec:"w"`
+	Any     interface{}    `codec:"a"`
+	Names   []string       `codec:"n"`
+	Keys    map[Key]uint64 `codec:"k,allocbound=4"`
+	Untag   int
+}
+
+type Bounded struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	Names  []string          `codec:"n,allocbound=4,allocbound=16"`
+	Set    map[string]uint64 `codec:"s,allocbound=8,allocbound=32"`
+	Capped []string          `codec:"c,maxtotalbytes=1024"`
+	cache  []string
+}
+
+type Untagged struct {
+	A []string
+}
@@ -0,0 +1,13 @@
+package mapkeys
+
+type Round uint64
+
+type Digest [4]byte
+
+type Keys struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	ByRound  map[Round]string  `codec:"r,allocbound=8,allocbound=-,allocbound=64"`
+	ByDigest map[Digest]uint64 `codec:"d,allocbound=8"`
+	ByString map[string]bool   `codec:"s,allocbound=8,allocbound=64"`
+}
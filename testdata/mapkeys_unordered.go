@@ -0,0 +1,7 @@
+package mapkeys
+
+type Unordered struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	ByFloat map[float64]string `codec:"f,allocbound=8"`
+}
@@ -0,0 +1,15 @@
+package maxsize
+
+//msgp:unbounded Checked
+
+type Checked struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	Names []string `codec:"n"`
+}
+
+type Bounded struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	A uint64 `codec:"a"`
+}
@@ -0,0 +1,19 @@
+package maxsize
+
+type Unbounded struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	Names []string `codec:"n"`
+}
+
+type Elems struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	Names []string `codec:"n,allocbound=8"`
+}
+
+type Keys struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	Counts map[string]uint64 `codec:"c,allocbound=8"`
+}
@@ -0,0 +1,6 @@
+package a
+
+type A struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+	X       uint64   `codec:"x"`
+}
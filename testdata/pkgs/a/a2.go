@@ -0,0 +1,6 @@
+package a
+
+type A2 struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+	A       A        `codec:"a"`
+}
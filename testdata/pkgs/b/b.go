@@ -0,0 +1,8 @@
+package b
+
+import "github.com/algorand/msgp/testdata/pkgs/a"
+
+type B struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+	A       a.A      `codec:"a"`
+}
@@ -0,0 +1,6 @@
+package tagged
+
+type Plain struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+	X       uint64   `codec:"x"`
+}
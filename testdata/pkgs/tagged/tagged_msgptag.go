@@ -0,0 +1,8 @@
+//go:build msgptag
+
+package tagged
+
+type Tagged struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+	Y       uint64   `codec:"y"`
+}
@@ -0,0 +1,10 @@
+package aliases
+
+// A is encoded with the key "name", which
+// was "n" and then "nm" in older encodings.
+type A struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	Name  string `codec:"name,alias=n,alias=nm,allocbound=16"`
+	Count uint64 `codec:"count"`
+}
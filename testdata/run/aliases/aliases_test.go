@@ -0,0 +1,60 @@
+package aliases
+
+import (
+	"testing"
+
+	"github.com/algorand/msgp/msgp"
+)
+
+// encode writes a map of the keys and values.
+func encode(kvs ...interface{}) []byte {
+	bts := msgp.AppendMapHeader(nil, uint32(len(kvs)/2))
+	for i := 0; i < len(kvs); i += 2 {
+		bts = msgp.AppendString(bts, kvs[i].(string))
+		switch v := kvs[i+1].(type) {
+		case string:
+			bts = msgp.AppendString(bts, v)
+		case uint64:
+			bts = msgp.AppendUint64(bts, v)
+		}
+	}
+	return bts
+}
+
+func TestAliasKeys(t *testing.T) {
+	for _, key := range []string{"name", "n", "nm"} {
+		var a A
+		if _, err := a.UnmarshalMsg(encode(key, "x", "count", uint64(1))); err != nil {
+			t.Fatalf("key %s: %v", key, err)
+		}
+		if a != (A{Name: "x", Count: 1}) {
+			t.Errorf("key %s: decoded %+v", key, a)
+		}
+	}
+}
+
+func TestAliasDuplicate(t *testing.T) {
+	for _, keys := range [][2]string{{"n", "name"}, {"name", "nm"}, {"n", "nm"}, {"name", "name"}} {
+		var a A
+		_, err := a.UnmarshalMsg(encode(keys[0], "x", keys[1], "y"))
+		if msgp.Cause(err) != msgp.ErrDuplicateField(keys[1]) {
+			t.Errorf("keys %v: decoded %+v, error %v", keys, a, err)
+		}
+	}
+}
+
+func TestAliasStrict(t *testing.T) {
+	st := msgp.DefaultUnmarshalState
+	st.Strict = true
+	var a A
+	if _, err := a.UnmarshalMsgWithState(encode("name", "x", "count", uint64(1)), st); err != nil {
+		t.Fatalf("strict decoding of the wire key: %v", err)
+	}
+	for _, key := range []string{"n", "nm", "unknown"} {
+		var a A
+		_, err := a.UnmarshalMsgWithState(encode(key, "x"), st)
+		if msgp.Cause(err) != msgp.ErrNoField(key) {
+			t.Errorf("strict decoding of key %s: %+v, error %v", key, a, err)
+		}
+	}
+}
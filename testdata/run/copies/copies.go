@@ -0,0 +1,21 @@
+package copies
+
+// C nests the types that MsgCopy copies deeply.
+type C struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	Bytes  []byte            `codec:"b,allocbound=8"`
+	Slices [][]uint64        `codec:"s,allocbound=4,allocbound=4"`
+	Map    map[string][]byte `codec:"m,allocbound=4,allocbound=8"`
+	Ptr    *Inner            `codec:"p"`
+	Inners []Inner           `codec:"i,allocbound=4"`
+	Array  [2]Inner          `codec:"a"`
+}
+
+// Inner is copied through its own MsgCopy.
+type Inner struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	N     uint64            `codec:"n"`
+	Names map[string]uint64 `codec:"names,allocbound=4"`
+}
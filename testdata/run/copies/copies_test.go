@@ -0,0 +1,39 @@
+package copies
+
+import (
+	"reflect"
+	"testing"
+)
+
+func value() C {
+	inner := func(n uint64) Inner { return Inner{N: n, Names: map[string]uint64{"x": n}} }
+	p := inner(1)
+	return C{
+		Bytes:  []byte{1, 2},
+		Slices: [][]uint64{{1, 2}, {3}},
+		Map:    map[string][]byte{"k": {4}},
+		Ptr:    &p,
+		Inners: []Inner{inner(2), inner(3)},
+		Array:  [2]Inner{inner(4), inner(5)},
+	}
+}
+
+func TestCopyIsDeep(t *testing.T) {
+	orig := value()
+	cp := orig.MsgCopy()
+	if !reflect.DeepEqual(cp, orig) {
+		t.Fatalf("copied %+v, expected %+v", cp, orig)
+	}
+
+	cp.Bytes[0] = 9
+	cp.Slices[0][0] = 9
+	cp.Map["k"][0] = 9
+	cp.Map["new"] = nil
+	cp.Ptr.N = 9
+	cp.Ptr.Names["x"] = 9
+	cp.Inners[0].Names["x"] = 9
+	cp.Array[1].Names["y"] = 9
+	if !reflect.DeepEqual(orig, value()) {
+		t.Errorf("mutating the copy changed the original to %+v", orig)
+	}
+}
@@ -0,0 +1,46 @@
+package equals
+
+// E nests slices and maps deeply enough that its MsgEqual
+// uses more than ten temporary variables.
+type E struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	Slices []Rows            `codec:"s,allocbound=4"`
+	Maps   map[string]Table  `codec:"m,allocbound=4"`
+	Mixed  []map[uint64]Sets `codec:"x,allocbound=4,allocbound=4"`
+	Inners map[string]Inners `codec:"i,allocbound=4"`
+	Bytes  [][]byte          `codec:"b,allocbound=4,allocbound=8"`
+}
+
+//msgp:allocbound Rows 4
+//msgp:allocbound Row 4
+//msgp:allocbound Table 4
+//msgp:allocbound Sets 4
+//msgp:allocbound Set 4
+//msgp:allocbound Inners 4
+
+// Rows is a slice of slices.
+type Rows []Row
+
+// Row is a slice.
+type Row []uint64
+
+// Table is a map of slices.
+type Table map[uint64]Row
+
+// Sets is a slice of maps.
+type Sets []Set
+
+// Set is a map.
+type Set map[uint64]bool
+
+// Inners is a slice of structs.
+type Inners []Inner
+
+// Inner is compared through its own MsgEqual.
+type Inner struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	N    uint64 `codec:"n"`
+	Keys Row    `codec:"k"`
+}
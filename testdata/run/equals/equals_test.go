@@ -0,0 +1,42 @@
+package equals
+
+import (
+	"bytes"
+	"testing"
+)
+
+func value() E {
+	return E{
+		Slices: []Rows{{{1, 2}, {3}}, {{4}}},
+		Maps:   map[string]Table{"a": {1: {1}, 2: {2, 3}}},
+		Mixed:  []map[uint64]Sets{{1: {{7: true}}, 2: {{8: false}}}},
+		Inners: map[string]Inners{"i": {{N: 1, Keys: Row{5}}}},
+		Bytes:  [][]byte{{1}, {}},
+	}
+}
+
+func TestEqual(t *testing.T) {
+	a := value()
+	for i, mutate := range []func(e *E){
+		func(e *E) {},
+		func(e *E) { e.Slices[0][1][0] = 9 },
+		func(e *E) { e.Slices[1] = append(e.Slices[1], nil) },
+		func(e *E) { e.Maps["a"][2][1] = 9 },
+		func(e *E) { e.Maps["a"][3] = e.Maps["a"][2]; delete(e.Maps["a"], 2) },
+		func(e *E) { e.Mixed[0][2][0][8] = true },
+		func(e *E) { e.Mixed[0][3] = e.Mixed[0][2]; delete(e.Mixed[0], 2) },
+		func(e *E) { e.Inners["i"][0].Keys[0] = 6 },
+		func(e *E) { e.Bytes[1] = nil },
+		func(e *E) { e.Maps = nil },
+	} {
+		b := value()
+		mutate(&b)
+		same := bytes.Equal(a.MarshalMsg(nil), b.MarshalMsg(nil))
+		if got := a.MsgEqual(&b); got != same {
+			t.Errorf("mutation %d: MsgEqual is %v, but the encodings are equal: %v", i, got, same)
+		}
+		if got := b.MsgEqual(&a); got != same {
+			t.Errorf("mutation %d: MsgEqual of the mutated value is %v, but the encodings are equal: %v", i, got, same)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package golden
+
+// G has golden files of its canonical encodings.
+type G struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	N     uint64            `codec:"n"`
+	Name  string            `codec:"name,allocbound=8"`
+	Names map[string]uint64 `codec:"names,allocbound=4,allocbound=8"`
+}
@@ -0,0 +1,15 @@
+package mapallocs
+
+type Round uint64
+
+type Digest [4]byte
+
+// Keys has maps whose keys are sorted in a stack buffer
+// when they have at most 8 keys.
+type Keys struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	ByRound  map[Round]string  `codec:"r,allocbound=16"`
+	ByDigest map[Digest]uint64 `codec:"d,allocbound=16"`
+	ByString map[string]bool   `codec:"s,allocbound=16"`
+}
@@ -0,0 +1,38 @@
+package mapallocs
+
+import (
+	"strconv"
+	"testing"
+)
+
+func keys(n int) Keys {
+	v := Keys{
+		ByRound:  make(map[Round]string),
+		ByDigest: make(map[Digest]uint64),
+		ByString: make(map[string]bool),
+	}
+	for i := 0; i < n; i++ {
+		v.ByRound[Round(n-i)] = "r"
+		v.ByDigest[Digest{byte(n - i)}] = uint64(i)
+		v.ByString[strconv.Itoa(n-i)] = true
+	}
+	return v
+}
+
+func TestMarshalSmallMapsAllocs(t *testing.T) {
+	for _, n := range []int{1, 8} {
+		v := keys(n)
+		bts := make([]byte, 0, v.Msgsize())
+		allocs := testing.AllocsPerRun(100, func() { bts = v.MarshalMsg(bts[:0]) })
+		if allocs != 0 {
+			t.Errorf("MarshalMsg of maps of %d keys allocates %v times", n, allocs)
+		}
+	}
+
+	// larger maps are sorted on the heap
+	v := keys(9)
+	bts := make([]byte, 0, v.Msgsize())
+	if allocs := testing.AllocsPerRun(100, func() { bts = v.MarshalMsg(bts[:0]) }); allocs == 0 {
+		t.Errorf("MarshalMsg of maps of 9 keys does not allocate")
+	}
+}
@@ -0,0 +1,36 @@
+package shimkeys
+
+import (
+	"strconv"
+	"time"
+)
+
+// Key is encoded as a decimal string, whose
+// order differs from the order of the numbers.
+type Key uint64
+
+//msgp:shim Key as:string using:keyString/parseKey
+//msgp:shim time.Time as:string using:timeString/parseTime
+
+func keyString(k Key) string { return strconv.FormatUint(uint64(k), 10) }
+
+func parseKey(s string) Key {
+	k, _ := strconv.ParseUint(s, 10, 64)
+	return Key(k)
+}
+
+func timeString(t time.Time) string { return t.UTC().Format(time.RFC3339) }
+
+func parseTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
+
+// M has maps with shimmed keys, of a local
+// type and of a type of another package.
+type M struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	Keys  map[Key]uint64       `codec:"k,allocbound=16"`
+	Times map[time.Time]uint64 `codec:"t,allocbound=16"`
+}
@@ -0,0 +1,78 @@
+package shimkeys
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/algorand/msgp/msgp"
+)
+
+// wireKeys returns the keys of the map encoded at
+// the start of bts, and the bytes that follow it.
+func wireKeys(t *testing.T, bts []byte) ([]string, []byte) {
+	n, _, bts, err := msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for i := 0; i < n; i++ {
+		var k string
+		if k, bts, err = msgp.ReadStringBytes(bts); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, k)
+		if bts, err = msgp.Skip(bts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return keys, bts
+}
+
+func TestShimmedKeysSorted(t *testing.T) {
+	v := M{
+		Keys: map[Key]uint64{2: 1, 10: 2, 9: 3, 100: 4, 1: 5},
+		Times: map[time.Time]uint64{
+			time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC):                     1,
+			time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC):                   2,
+			time.Date(2024, 1, 1, 20, 0, 0, 0, time.FixedZone("", -5*3600)): 3,
+		},
+	}
+	bts := v.MarshalMsg(nil)
+
+	// the struct is a map of the fields k and t
+	_, _, rest, err := msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []struct {
+		name string
+		want []string
+	}{
+		{"k", []string{"1", "10", "100", "2", "9"}},
+		{"t", []string{"2023-12-31T00:00:00Z", "2024-01-02T00:00:00Z", "2024-01-02T01:00:00Z"}},
+	} {
+		var name string
+		if name, rest, err = msgp.ReadStringBytes(rest); err != nil || name != field.name {
+			t.Fatalf("field %q, error %v; expected %q", name, err, field.name)
+		}
+		var keys []string
+		keys, rest = wireKeys(t, rest)
+		if !sort.StringsAreSorted(keys) || len(keys) != len(field.want) {
+			t.Errorf("the keys of %s are encoded as %q", field.name, keys)
+		}
+		for i := range keys {
+			if keys[i] != field.want[i] {
+				t.Errorf("the keys of %s are encoded as %q, expected %q", field.name, keys, field.want)
+				break
+			}
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		if again := v.MarshalMsg(nil); !bytes.Equal(bts, again) {
+			t.Fatalf("%#v was encoded as %x, then as %x", v, bts, again)
+		}
+	}
+}
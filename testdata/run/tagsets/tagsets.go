@@ -0,0 +1,8 @@
+package tagsets
+
+// Plain is generated for every tag set.
+type Plain struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	X uint64 `codec:"x"`
+}
@@ -0,0 +1,10 @@
+//go:build rocksdb
+
+package tagsets
+
+// Rocks is only generated for the tag set with rocksdb.
+type Rocks struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	Y uint64 `codec:"y"`
+}
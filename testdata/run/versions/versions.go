@@ -0,0 +1,44 @@
+package versions
+
+import "github.com/algorand/msgp/msgp"
+
+// V has fields added in version 3 and retired in version 3.
+type V struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	A   uint64 `codec:"a"`
+	New uint64 `codec:"new,since=3"`
+	Old uint64 `codec:"old,until=3"`
+	H   Hand   `codec:"h"`
+}
+
+//msgp:ignore Hand
+
+// Hand is a hand-written Marshaler, without MarshalMsgWithState.
+type Hand uint64
+
+func (h Hand) MarshalMsg(b []byte) []byte { return msgp.AppendUint64(b, uint64(h)) }
+
+func (h Hand) CanMarshalMsg(o interface{}) bool {
+	_, ok := o.(Hand)
+	return ok
+}
+
+func (h *Hand) UnmarshalMsg(b []byte) ([]byte, error) {
+	return h.UnmarshalMsgWithState(b, msgp.DefaultUnmarshalState)
+}
+
+func (h *Hand) UnmarshalMsgWithState(b []byte, st msgp.UnmarshalState) ([]byte, error) {
+	v, b, err := msgp.ReadUint64Bytes(b)
+	*h = Hand(v)
+	return b, err
+}
+
+func (h *Hand) CanUnmarshalMsg(o interface{}) bool {
+	_, ok := o.(*Hand)
+	return ok
+}
+
+func (h Hand) Msgsize() int { return msgp.Uint64Size }
+
+func (h Hand) MsgIsZero() bool { return h == 0 }
@@ -0,0 +1,75 @@
+package versions
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/algorand/msgp/msgp"
+)
+
+func TestVersionRoundTrip(t *testing.T) {
+	v := V{A: 1, New: 2, Old: 3, H: 4}
+	for _, c := range []struct {
+		version uint64
+		want    V
+	}{
+		{0, V{A: 1, New: 2, Old: 3, H: 4}},
+		{2, V{A: 1, Old: 3, H: 4}},
+		{3, V{A: 1, New: 2, H: 4}},
+		{7, V{A: 1, New: 2, H: 4}},
+	} {
+		bts := v.MarshalMsgWithState(nil, msgp.MarshalState{Version: c.version})
+		st := msgp.DefaultUnmarshalState
+		st.Version = c.version
+		var got V
+		if _, err := got.UnmarshalMsgWithState(bts, st); err != nil {
+			t.Fatalf("version %d: %v", c.version, err)
+		}
+		if got != c.want {
+			t.Errorf("version %d: decoded %+v, want %+v", c.version, got, c.want)
+		}
+	}
+}
+
+func TestVersionRejected(t *testing.T) {
+	// the encoding without version checks has both fields
+	bts := (&V{A: 1, New: 2, Old: 3}).MarshalMsg(nil)
+	for _, version := range []uint64{2, 3} {
+		st := msgp.DefaultUnmarshalState
+		st.Version = version
+		var got V
+		_, err := got.UnmarshalMsgWithState(bts, st)
+		var fe msgp.FieldVersionError
+		if !errors.As(err, &fe) {
+			t.Errorf("version %d: decoded a field outside its range: %v", version, err)
+		}
+	}
+}
+
+func TestVersionArray(t *testing.T) {
+	// an array encoding has every field, in declaration order:
+	// A, New, Old, H; New is zero in data from before version 3
+	array := func(a, new, old, h uint64) []byte {
+		bts := msgp.AppendArrayHeader(nil, 4)
+		for _, u := range []uint64{a, new, old, h} {
+			bts = msgp.AppendUint64(bts, u)
+		}
+		return bts
+	}
+	st := msgp.DefaultUnmarshalState
+	st.Version = 2
+	var got V
+	if _, err := got.UnmarshalMsgWithState(array(1, 0, 3, 4), st); err != nil {
+		t.Fatal(err)
+	}
+	if want := (V{A: 1, Old: 3, H: 4}); got != want {
+		t.Errorf("decoded %+v, want %+v", got, want)
+	}
+
+	got = V{}
+	_, err := got.UnmarshalMsgWithState(array(1, 2, 3, 4), st)
+	var fe msgp.FieldVersionError
+	if !errors.As(err, &fe) {
+		t.Errorf("decoded a field outside its range: %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package schema
+
+import (
+	"time"
+
+	"github.com/algorand/msgp/msgp"
+)
+
+//msgp:shim time.Month as:string using:monthToString/monthFromString
+//msgp:tuple Point
+
+type Point struct {
+	Y int64 `codec:"y"`
+	X int64 `codec:"x"`
+}
+
+type Record struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	Name  string             `codec:"n,allocbound=64"`
+	Tags  []string           `codec:"t,allocbound=8,allocbound=32"`
+	Month time.Month         `codec:"m"`
+	Ext   *msgp.RawExtension `codec:"e,extension"`
+	Where Point              `codec:"p"`
+	Old   uint64             `codec:"o,since=2"`
+}
+
+func monthToString(m time.Month) string   { return m.String() }
+func monthFromString(s string) time.Month { return time.January }